@@ -0,0 +1,267 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bucket is total of in/out within time range, started at Start.
+type Bucket struct {
+	Start    time.Time `json:"start"`
+	In       int       `json:"in"`
+	Out      int       `json:"out"`
+	Peak     int       `json:"peak"`      // peak occupancy within bucket, counted from local midnight
+	FocusOut int       `json:"focus_out"` // number of events recorded while out of focus, which in/out are unreliable
+}
+
+// Aggregator keep in/out of devices and zones, bucketed by time.
+//
+// Buckets are aligned to local midnight,
+// so BucketSize should divide a day, such as 15 minutes or 1 hour.
+//
+// Aggregator does not detect duplicated events,
+// feed it with events counted by counter only.
+//
+// Peak is evaluated from in/out since local midnight, when query,
+// so events come out of order are evaluated correctly, as long as
+// events within a bucket are in order.
+type Aggregator struct {
+	bucketSize time.Duration
+	retention  time.Duration // 0 means keep forever
+	zones      ZoneMap
+
+	series map[string]*series // key is device or zone
+	pruned time.Time          // when all series pruned last
+	mux    *sync.RWMutex
+}
+
+// series is buckets of one device or zone
+type series struct {
+	buckets map[int64]*bucket // key is unix time of Bucket.Start
+	oldest  int64             // smallest key of buckets
+}
+
+// bucket is Bucket, with highest in - out within it, to evaluate Peak
+type bucket struct {
+	Bucket
+	rise int
+}
+
+// NewAggregator create Aggregator, which keep buckets of `bucketSize` for `retention`.
+//
+// `retention` of 0 means keep forever.
+// Events of devices in `zones` aggregated for zone too, `zones` can be nil.
+func NewAggregator(bucketSize, retention time.Duration, zones ZoneMap) *Aggregator {
+	return &Aggregator{
+		bucketSize: bucketSize,
+		retention:  retention,
+		zones:      zones,
+		series:     make(map[string]*series),
+		mux:        &sync.RWMutex{},
+	}
+}
+
+func deviceKey(serialNumber uint32) string {
+	return "device/" + SerialString(serialNumber)
+}
+
+func zoneKey(zone string) string {
+	return "zone/" + zone
+}
+
+// Add aggregate events.
+//
+// Buckets out of retention are pruned from series of events,
+// and from other series once an hour.
+func (a *Aggregator) Add(events ...Event) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	now := time.Now()
+	for _, e := range events {
+		a.add(deviceKey(e.SerialNumber), e, now)
+		if zone := a.zones.Zone(e.SerialNumber); zone != "" {
+			a.add(zoneKey(zone), e, now)
+		}
+	}
+
+	if now.Sub(a.pruned) >= time.Hour {
+		a.pruned = now
+		for _, s := range a.series {
+			a.prune(s, now)
+		}
+	}
+}
+
+func (a *Aggregator) add(key string, e Event, now time.Time) {
+	s, ok := a.series[key]
+	if !ok {
+		s = &series{buckets: make(map[int64]*bucket)}
+		a.series[key] = s
+	}
+
+	start := alignTime(e.EventTime, a.bucketSize)
+	b, ok := s.buckets[start.Unix()]
+	if !ok {
+		b = &bucket{Bucket: Bucket{Start: start}}
+		if len(s.buckets) == 0 || start.Unix() < s.oldest {
+			s.oldest = start.Unix()
+		}
+		s.buckets[start.Unix()] = b
+	}
+
+	b.In += int(e.DxIn)
+	b.Out += int(e.DxOut)
+	if !e.Focused() {
+		b.FocusOut++
+	}
+	if net := b.In - b.Out; net > b.rise {
+		b.rise = net
+	}
+	a.prune(s, now)
+}
+
+// prune delete buckets of series older than retention.
+// It walk buckets only when oldest one is out of retention.
+func (a *Aggregator) prune(s *series, now time.Time) {
+	if a.retention == 0 || len(s.buckets) == 0 {
+		return
+	}
+	limit := now.Add(-a.retention).Unix()
+	if s.oldest >= limit {
+		return
+	}
+
+	first := true
+	for k := range s.buckets {
+		if k < limit {
+			delete(s.buckets, k)
+			continue
+		}
+		if first || k < s.oldest {
+			s.oldest = k
+			first = false
+		}
+	}
+}
+
+// Device returns buckets of device within [from, to), merged by `step`.
+//
+// `step` is multiple of bucket size, such as time.Hour, 24*time.Hour for daily,
+// and 7*24*time.Hour for weekly, which starts on Monday.
+func (a *Aggregator) Device(serialNumber uint32, from, to time.Time, step time.Duration) []Bucket {
+	return a.query(deviceKey(serialNumber), from, to, step)
+}
+
+// Zone returns buckets of zone within [from, to), merged by `step`.
+//
+// See Device about `step`.
+func (a *Aggregator) Zone(zone string, from, to time.Time, step time.Duration) []Bucket {
+	return a.query(zoneKey(zone), from, to, step)
+}
+
+func (a *Aggregator) query(key string, from, to time.Time, step time.Duration) []Bucket {
+	if step < a.bucketSize {
+		step = a.bucketSize
+	}
+
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+
+	s, ok := a.series[key]
+	if !ok {
+		return nil
+	}
+
+	merged := make(map[int64]*Bucket)
+	for _, b := range s.peaks() {
+		if b.Start.Before(from) || !b.Start.Before(to) {
+			continue
+		}
+		start := alignTime(b.Start, step)
+		m, ok := merged[start.Unix()]
+		if !ok {
+			m = &Bucket{Start: start, Peak: b.Peak}
+			merged[start.Unix()] = m
+		}
+		m.In += b.In
+		m.Out += b.Out
+		m.FocusOut += b.FocusOut
+		if b.Peak > m.Peak {
+			m.Peak = b.Peak
+		}
+	}
+
+	result := make([]Bucket, 0, len(merged))
+	for _, m := range merged {
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+// peaks returns buckets ordered by Start, with Peak evaluated.
+// Occupancy starts from 0 at local midnight.
+func (s *series) peaks() []Bucket {
+	buckets := make([]*bucket, 0, len(s.buckets))
+	for _, b := range s.buckets {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+
+	result := make([]Bucket, len(buckets))
+	var day time.Time
+	occupancy := 0 // at start of bucket
+	for i, b := range buckets {
+		if midnight := alignTime(b.Start, 24*time.Hour); !midnight.Equal(day) {
+			day = midnight
+			occupancy = 0
+		}
+		result[i] = b.Bucket
+		result[i].Peak = occupancy + b.rise
+		occupancy += b.In - b.Out
+	}
+	return result
+}
+
+// alignTime returns start of bucket of `size`, which `t` belongs to.
+//
+// Bucket shorter than a day aligned to local midnight,
+// a day aligned to midnight, a week aligned to Monday.
+// Other size just truncated.
+//
+// Alignment is by wall clock, so buckets keep aligned on day of daylight saving change.
+func alignTime(t time.Time, size time.Duration) time.Time {
+	const day = 24 * time.Hour
+
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+
+	switch {
+	case size <= 0:
+		return t
+	case size < day && day%size == 0:
+		hour, minute, second := t.Clock()
+		clock := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+			time.Duration(second)*time.Second + time.Duration(t.Nanosecond())
+		clock = clock / size * size
+		return time.Date(y, m, d,
+			int(clock/time.Hour), int(clock%time.Hour/time.Minute), int(clock%time.Minute/time.Second), int(clock%time.Second),
+			t.Location())
+	case size == day:
+		return midnight
+	case size == 7*day:
+		offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+		return midnight.AddDate(0, 0, -offset)
+	default:
+		return t.Truncate(size)
+	}
+}
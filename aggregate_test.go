@@ -0,0 +1,185 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2021, 5, day, hour, minute, 0, 0, time.Local)
+	}
+	event := func(serialNumber uint32, t time.Time, in, out uint32) Event {
+		return Event{SerialNumber: serialNumber, EventTime: t, DxIn: in, DxOut: out}
+	}
+
+	a := NewAggregator(15*time.Minute, 0, ZoneMap{1: "lobby", 2: "lobby"})
+	a.Add(
+		event(1, at(13, 9, 0), 3, 0),
+		event(2, at(13, 9, 20), 2, 0),
+		event(1, at(13, 9, 50), 0, 4),
+		event(1, at(13, 10, 10), 2, 0), // one person left at end of day
+		event(1, at(14, 9, 10), 0, 1),
+	)
+
+	tests := []struct {
+		name string
+		got  []Bucket
+		want []Bucket
+	}{
+		{
+			name: "device hourly",
+			got:  a.Device(1, at(13, 0, 0), at(14, 0, 0), time.Hour),
+			want: []Bucket{
+				{Start: at(13, 9, 0), In: 3, Out: 4, Peak: 3},
+				{Start: at(13, 10, 0), In: 2, Out: 0, Peak: 1},
+			},
+		},
+		{
+			name: "zone hourly",
+			got:  a.Zone("lobby", at(13, 0, 0), at(14, 0, 0), time.Hour),
+			want: []Bucket{
+				{Start: at(13, 9, 0), In: 5, Out: 4, Peak: 5},
+				{Start: at(13, 10, 0), In: 2, Out: 0, Peak: 3},
+			},
+		},
+		{
+			name: "device daily",
+			got:  a.Device(1, at(1, 0, 0), at(31, 0, 0), 24*time.Hour),
+			want: []Bucket{
+				{Start: at(13, 0, 0), In: 5, Out: 4, Peak: 3},
+				// not affected by balance of previous day
+				{Start: at(14, 0, 0), In: 0, Out: 1, Peak: 0},
+			},
+		},
+		{
+			name: "device weekly",
+			got:  a.Device(1, at(1, 0, 0), at(31, 0, 0), 7*24*time.Hour),
+			want: []Bucket{
+				{Start: at(10, 0, 0), In: 5, Out: 5, Peak: 3},
+			},
+		},
+		{
+			name: "unknown zone",
+			got:  a.Zone("hall", at(1, 0, 0), at(31, 0, 0), time.Hour),
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregatorOutOfOrder(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2021, 5, 13, hour, minute, 0, 0, time.Local)
+	}
+
+	a := NewAggregator(time.Hour, 0, nil)
+	// cache of later hour uploaded first
+	a.Add(Event{SerialNumber: 1, EventTime: at(10, 0), DxIn: 1})
+	a.Add(Event{SerialNumber: 1, EventTime: at(9, 0), DxIn: 3}, Event{SerialNumber: 1, EventTime: at(9, 30), DxOut: 1})
+
+	want := []Bucket{
+		{Start: at(9, 0), In: 3, Out: 1, Peak: 3},
+		{Start: at(10, 0), In: 1, Out: 0, Peak: 3},
+	}
+	if got := a.Device(1, at(0, 0), at(23, 0), 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("Device() = %v, want %v", got, want)
+	}
+}
+
+func TestAggregatorFocusOut(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2021, 5, 13, hour, minute, 0, 0, time.Local)
+	}
+
+	a := NewAggregator(15*time.Minute, 0, ZoneMap{1: "lobby"})
+	a.Add(
+		Event{SerialNumber: 1, EventTime: at(9, 0), DxIn: 1},
+		Event{SerialNumber: 1, EventTime: at(9, 5), DxIn: 2, Focus: FocusOut},
+		Event{SerialNumber: 1, EventTime: at(9, 20), DxOut: 1, Focus: FocusOut},
+		Event{SerialNumber: 1, EventTime: at(10, 0), DxOut: 1},
+	)
+
+	want := []Bucket{
+		{Start: at(9, 0), In: 3, Out: 0, Peak: 3, FocusOut: 1},
+		{Start: at(9, 15), In: 0, Out: 1, Peak: 3, FocusOut: 1},
+		{Start: at(10, 0), In: 0, Out: 1, Peak: 2},
+	}
+	if got := a.Device(1, at(0, 0), at(23, 0), 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("Device() = %v, want %v", got, want)
+	}
+
+	// merged by step, and counted for zone too
+	want = []Bucket{
+		{Start: at(9, 0), In: 3, Out: 1, Peak: 3, FocusOut: 2},
+		{Start: at(10, 0), In: 0, Out: 1, Peak: 2},
+	}
+	if got := a.Zone("lobby", at(0, 0), at(23, 0), time.Hour); !reflect.DeepEqual(got, want) {
+		t.Errorf("Zone() = %v, want %v", got, want)
+	}
+}
+
+func TestAggregatorPrune(t *testing.T) {
+	now := time.Now()
+	a := NewAggregator(15*time.Minute, 24*time.Hour, nil)
+	a.Add(
+		Event{SerialNumber: 1, EventTime: now.Add(-30 * time.Hour), DxIn: 1},
+		Event{SerialNumber: 1, EventTime: now.Add(-3 * time.Hour), DxIn: 1},
+		Event{SerialNumber: 1, EventTime: now.Add(-30 * time.Minute), DxIn: 1},
+	)
+	if got := a.Device(1, time.Time{}, now.Add(time.Hour), 0); len(got) != 2 {
+		t.Errorf("Device() = %v, want 2 buckets in retention", got)
+	}
+	if got, want := a.series[deviceKey(1)].oldest, alignTime(now.Add(-3*time.Hour), 15*time.Minute).Unix(); got != want {
+		t.Errorf("oldest = %v, want %v", got, want)
+	}
+
+	// series not added is pruned too
+	a.retention = time.Hour
+	a.pruned = time.Time{}
+	a.Add(Event{SerialNumber: 2, EventTime: now, DxIn: 1})
+	if got := a.Device(1, time.Time{}, now.Add(time.Hour), 0); len(got) != 1 {
+		t.Errorf("Device() = %v, want 1 bucket in retention", got)
+	}
+}
+
+func TestAlignTimeDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("LoadLocation() error = %v", err)
+	}
+
+	// clock turned back from 02:00 to 01:00
+	after := time.Date(2021, 11, 7, 6, 30, 0, 0, time.UTC).In(loc) // 01:30 EST, second time
+	later := time.Date(2021, 11, 7, 7, 30, 0, 0, time.UTC).In(loc) // 02:30 EST
+
+	tests := []struct {
+		name string
+		t    time.Time
+		size time.Duration
+		hour int
+	}{
+		{"2 hours", later, 2 * time.Hour, 2},
+		{"2 hours, repeated clock", after, 2 * time.Hour, 0},
+		{"1 hour", later, time.Hour, 2},
+		{"day", later, 24 * time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := alignTime(tt.t, tt.size)
+			if got.Hour() != tt.hour || got.Minute() != 0 || got.Day() != 7 {
+				t.Errorf("alignTime() = %v, want %02d:00", got, tt.hour)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Battery of BatteryAlert
+const (
+	BatteryTransmitter = "transmitter" // battery of infrared transmitter
+	BatteryCounter     = "counter"     // battery of counter(receiver)
+)
+
+// maxBatterySamples is number of BatterySample, kept for each device
+const maxBatterySamples = 1000
+
+// batterySampleInterval is interval to keep sample, while battery not changed.
+// With maxBatterySamples, history cover weeks, even if device upload every minute.
+const batterySampleInterval = time.Hour
+
+// batteryRecovery is percent of battery to rise, to be treated as charged or replaced.
+// Smaller rise is noise of reading.
+const batteryRecovery = 10
+
+// BatterySample is battery status of device, at Time.
+type BatterySample struct {
+	Time           time.Time `json:"time"`
+	TransmitterBAT byte      `json:"transmitter_bat"`
+	CounterBAT     byte      `json:"counter_bat"`
+	Charge         Charge    `json:"charge"`
+}
+
+// BatteryThreshold is percent of battery to alert, 0 disables alert.
+type BatteryThreshold struct {
+	Transmitter byte
+	Counter     byte
+}
+
+// BatteryAlert represent battery of device is low.
+type BatteryAlert struct {
+	SerialNumber  uint32
+	Time          time.Time
+	Battery       string // BatteryTransmitter or BatteryCounter
+	Level         byte
+	Threshold     byte
+	DaysRemaining float64 // negative if unknown
+}
+
+// BatteryMonitor keep battery history of devices, and alert low battery.
+//
+// To avoid alert by noisy reading, alert raised only when battery is low
+// for `debounce` consecutive samples, and raised once until battery recovered,
+// by charging or replacement, to `threshold` + 10% at least.
+//
+// Give it to Handler.Battery. ObserveCache of nil BatteryMonitor does nothing.
+type BatteryMonitor struct {
+	threshold BatteryThreshold
+	debounce  int
+	callback  func(BatteryAlert)
+
+	history map[uint32][]BatterySample // oldest first
+	low     map[batteryKey]int         // number of consecutive low samples
+	alerted map[batteryKey]bool
+	mux     *sync.Mutex
+}
+
+type batteryKey struct {
+	serialNumber uint32
+	battery      string
+}
+
+// NewBatteryMonitor create BatteryMonitor.
+//
+// `callback` called when battery become low.
+func NewBatteryMonitor(threshold BatteryThreshold, debounce int, callback func(BatteryAlert)) *BatteryMonitor {
+	if debounce < 1 {
+		debounce = 1
+	}
+	return &BatteryMonitor{
+		threshold: threshold,
+		debounce:  debounce,
+		callback:  callback,
+		history:   make(map[uint32][]BatterySample),
+		low:       make(map[batteryKey]int),
+		alerted:   make(map[batteryKey]bool),
+		mux:       &sync.Mutex{},
+	}
+}
+
+// ObserveCache record battery status of cache request.
+func (m *BatteryMonitor) ObserveCache(status *DeviceStatus, received time.Time) {
+	if m == nil {
+		return
+	}
+
+	sample := BatterySample{
+		Time:           received,
+		TransmitterBAT: status.TransmitterBAT,
+		CounterBAT:     status.CounterBAT,
+		Charge:         status.Charge,
+	}
+
+	var alerts []BatteryAlert
+
+	m.mux.Lock()
+	history := m.history[status.SerialNumber]
+	if len(history) == 0 || sampleChanged(history[len(history)-1], sample) {
+		history = append(history, sample)
+		if len(history) > maxBatterySamples {
+			history = history[len(history)-maxBatterySamples:]
+		}
+		m.history[status.SerialNumber] = history
+	}
+
+	if alert, ok := m.check(status.SerialNumber, BatteryTransmitter, sample.TransmitterBAT, m.threshold.Transmitter, sample.Time); ok {
+		alerts = append(alerts, alert)
+	}
+	// counter battery rise while charging, no need to alert
+	if sample.Charge != BeingCharged {
+		if alert, ok := m.check(status.SerialNumber, BatteryCounter, sample.CounterBAT, m.threshold.Counter, sample.Time); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+	m.mux.Unlock()
+
+	for _, alert := range alerts {
+		debugf("- low battery: %s %s %d%%\n", SerialString(alert.SerialNumber), alert.Battery, alert.Level)
+		if m.callback != nil {
+			m.callback(alert)
+		}
+	}
+}
+
+// sampleChanged returns whether `sample` should be kept after `last`,
+// which battery changed, or batterySampleInterval passed.
+func sampleChanged(last, sample BatterySample) bool {
+	return last.TransmitterBAT != sample.TransmitterBAT ||
+		last.CounterBAT != sample.CounterBAT ||
+		last.Charge != sample.Charge ||
+		sample.Time.Sub(last.Time) >= batterySampleInterval
+}
+
+// check returns alert if battery become low. Caller must hold lock.
+func (m *BatteryMonitor) check(serialNumber uint32, battery string, level, threshold byte, t time.Time) (BatteryAlert, bool) {
+	key := batteryKey{serialNumber, battery}
+	if threshold == 0 || level > threshold {
+		m.low[key] = 0
+		// level jittering around threshold is not recovery
+		if threshold == 0 || int(level) >= int(threshold)+batteryRecovery {
+			m.alerted[key] = false
+		}
+		return BatteryAlert{}, false
+	}
+
+	m.low[key]++
+	if m.alerted[key] || m.low[key] < m.debounce {
+		return BatteryAlert{}, false
+	}
+	m.alerted[key] = true
+
+	days, ok := estimateDays(m.history[serialNumber], battery)
+	if !ok {
+		days = -1
+	}
+	return BatteryAlert{
+		SerialNumber:  serialNumber,
+		Time:          t,
+		Battery:       battery,
+		Level:         level,
+		Threshold:     threshold,
+		DaysRemaining: days,
+	}, true
+}
+
+// History returns battery samples of device, oldest first.
+// Samples are kept when battery changed, and every hour while not changed.
+func (m *BatteryMonitor) History(serialNumber uint32) []BatterySample {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return append([]BatterySample(nil), m.history[serialNumber]...)
+}
+
+// DaysRemaining estimate days until battery of device run out,
+// by discharge rate since battery last recovered.
+// If it can not be estimated, such as not enough samples, returns false.
+func (m *BatteryMonitor) DaysRemaining(serialNumber uint32, battery string) (float64, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return estimateDays(m.history[serialNumber], battery)
+}
+
+// estimateDays fit line to samples since battery last recovered, by least squares
+func estimateDays(history []BatterySample, battery string) (float64, bool) {
+	level := func(s BatterySample) float64 {
+		if battery == BatteryTransmitter {
+			return float64(s.TransmitterBAT)
+		}
+		return float64(s.CounterBAT)
+	}
+
+	// samples since battery replaced or charged,
+	// which rise from lowest level by batteryRecovery
+	begin := 0
+	lowest := math.Inf(1)
+	for i, s := range history {
+		if level(s) >= lowest+batteryRecovery {
+			begin = i
+			lowest = level(s)
+		}
+		lowest = math.Min(lowest, level(s))
+	}
+	samples := history[begin:]
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	origin := samples[0].Time
+	for _, s := range samples {
+		x := s.Time.Sub(origin).Hours() / 24
+		y := level(s)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator // percent per day
+	if slope >= 0 {
+		return 0, false
+	}
+
+	last := samples[len(samples)-1]
+	return level(last) / -slope, true
+}
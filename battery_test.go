@@ -0,0 +1,79 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBatteryMonitor(t *testing.T) {
+	var alerts []BatteryAlert
+	m := NewBatteryMonitor(BatteryThreshold{Transmitter: 20, Counter: 10}, 2, func(a BatteryAlert) {
+		alerts = append(alerts, a)
+	})
+
+	begin := time.Date(2021, 5, 1, 12, 0, 0, 0, time.Local)
+	observe := func(day int, transmitter, counter byte) {
+		m.ObserveCache(&DeviceStatus{SerialNumber: 1, TransmitterBAT: transmitter, CounterBAT: counter}, begin.AddDate(0, 0, day))
+	}
+
+	// transmitter lose 2% a day
+	observe(0, 30, 50)
+	observe(1, 28, 50)
+	observe(2, 26, 50)
+	observe(5, 20, 50) // low, but debounced
+	observe(6, 18, 50) // alert
+	observe(7, 16, 50) // already alerted
+	observe(7, 21, 50) // jitter, not recovered
+	observe(7, 16, 50)
+	observe(7, 17, 50)
+
+	if len(alerts) != 1 {
+		t.Fatalf("alerts = %v, want one alert", alerts)
+	}
+	if a := alerts[0]; a.Battery != BatteryTransmitter || a.Level != 18 || math.Abs(a.DaysRemaining-9) > 0.01 {
+		t.Errorf("alert = %+v, want transmitter 18%% with 9 days remaining", a)
+	}
+	// jitter not restart estimation
+	if days, ok := m.DaysRemaining(1, BatteryTransmitter); !ok || days <= 0 {
+		t.Errorf("DaysRemaining() = %v, %v, want estimated from first sample", days, ok)
+	}
+
+	// replaced, and low again
+	observe(8, 100, 50)
+	if days, ok := m.DaysRemaining(1, BatteryTransmitter); ok {
+		t.Errorf("DaysRemaining() = %v, want unknown after replaced", days)
+	}
+	observe(9, 15, 50)
+	observe(10, 15, 50)
+	if len(alerts) != 2 {
+		t.Errorf("alerts = %v, want alert again after replaced", alerts)
+	}
+
+	if got := len(m.History(1)); got != 12 {
+		t.Errorf("len(History()) = %d, want %d", got, 12)
+	}
+}
+
+func TestBatteryMonitorEveryMinute(t *testing.T) {
+	m := NewBatteryMonitor(BatteryThreshold{}, 1, nil)
+
+	// upload every minute for 3 days, transmitter lose 1% a day
+	begin := time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local)
+	for i := 0; i < 3*24*60; i++ {
+		received := begin.Add(time.Duration(i) * time.Minute)
+		level := byte(90 - i/(24*60))
+		m.ObserveCache(&DeviceStatus{SerialNumber: 1, TransmitterBAT: level, CounterBAT: 50}, received)
+	}
+
+	if got := len(m.History(1)); got != 3*24 {
+		t.Errorf("len(History()) = %d, want %d", got, 3*24)
+	}
+	// level drop by step, so estimation is rough, but not far from 88 days
+	if days, ok := m.DaysRemaining(1, BatteryTransmitter); !ok || math.Abs(days-88) > 15 {
+		t.Errorf("DaysRemaining() = %v, %v, want about %v", days, ok, 88)
+	}
+}
@@ -0,0 +1,94 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import "time"
+
+// Capacity is thresholds of occupants, to be Crowded and Full.
+//
+// To avoid level flip-flop around threshold,
+// level goes down only when occupants fall Hysteresis below threshold.
+// For example, with Full 10 and Hysteresis 2,
+// level become Full at 10 occupants, and become Crowded again at 8.
+type Capacity struct {
+	Warning    int // occupants to be Crowded, 0 means no warning
+	Full       int // occupants to be Full, 0 means no limit. It is upper bound of DriftPolicy too
+	Hysteresis int
+}
+
+// CapacityEvent represent level changed.
+type CapacityEvent struct {
+	Time      time.Time
+	Previous  CapacityLevel
+	Level     CapacityLevel
+	Occupants int
+}
+
+// SetCapacity set thresholds of counter,
+// and `callback` called whenever level changed.
+//
+// `callback` called after counter unlocked, so it can use counter,
+// but it should return quickly, as it blocks counting.
+func (c *counter) SetCapacity(capacity Capacity, callback func(CapacityEvent)) {
+	c.mux.Lock()
+	defer c.unlock()
+
+	c.capacity = capacity
+	c.capacityCallback = callback
+	c.checkCapacity(time.Now())
+}
+
+// Level returns current level of counter.
+func (c *counter) Level() CapacityLevel {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.capacityLevel
+}
+
+// level returns level of `occupants`, when current level is `current`
+func (capacity Capacity) level(current CapacityLevel, occupants int) CapacityLevel {
+	next := Available
+	if capacity.Warning > 0 && occupants >= capacity.Warning {
+		next = Crowded
+	}
+	if capacity.Full > 0 && occupants >= capacity.Full {
+		next = Full
+	}
+
+	// stay on higher level, until occupants fall enough
+	if next < current {
+		if current == Full && capacity.Full > 0 && occupants > capacity.Full-capacity.Hysteresis {
+			return Full
+		}
+		if next < Crowded && capacity.Warning > 0 && occupants > capacity.Warning-capacity.Hysteresis {
+			return Crowded
+		}
+	}
+	return next
+}
+
+// checkCapacity update level, and queue callback if it changed.
+// Caller must hold lock.
+func (c *counter) checkCapacity(t time.Time) {
+	occupants := c.clamp(c.occupants())
+	level := c.capacity.level(c.capacityLevel, occupants)
+	if level == c.capacityLevel {
+		return
+	}
+
+	event := CapacityEvent{
+		Time:      t,
+		Previous:  c.capacityLevel,
+		Level:     level,
+		Occupants: occupants,
+	}
+	c.capacityLevel = level
+
+	debugf("- capacity: %v -> %v (%d)\n", event.Previous, event.Level, event.Occupants)
+
+	if callback := c.capacityCallback; callback != nil {
+		c.pending = append(c.pending, func() { callback(event) })
+	}
+}
@@ -0,0 +1,59 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import "testing"
+
+func TestCapacityLevel(t *testing.T) {
+	capacity := Capacity{Warning: 6, Full: 10, Hysteresis: 2}
+
+	tests := []struct {
+		current   CapacityLevel
+		occupants int
+		want      CapacityLevel
+	}{
+		{Available, 5, Available},
+		{Available, 6, Crowded},
+		{Available, 12, Full},
+		{Crowded, 9, Crowded},
+		{Crowded, 5, Crowded},
+		{Crowded, 4, Available},
+		{Full, 9, Full},
+		{Full, 8, Crowded},
+		{Full, 3, Available},
+	}
+	for _, tt := range tests {
+		if got := capacity.level(tt.current, tt.occupants); got != tt.want {
+			t.Errorf("level(%v, %d) = %v, want %v", tt.current, tt.occupants, got, tt.want)
+		}
+	}
+}
+
+func TestCounterCapacity(t *testing.T) {
+	c := Counter()
+	defer c.Close()
+
+	var events []CapacityEvent
+	c.SetCapacity(Capacity{Warning: 2, Full: 3, Hysteresis: 1}, func(e CapacityEvent) {
+		// counter must be usable in callback
+		if got := c.GetOccupants(); got != e.Occupants {
+			t.Errorf("GetOccupants() = %d, want %d", got, e.Occupants)
+		}
+		events = append(events, e)
+	})
+
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 1, DxIn: 3})
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 2, Dxout: 1})
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 3, Dxout: 1})
+
+	if len(events) != 3 {
+		t.Fatalf("callback called %d times, want %d: %v", len(events), 3, events)
+	}
+	if events[0].Level != Full || events[1].Level != Crowded || events[2].Level != Available {
+		t.Errorf("events = %v, want Full, Crowded, Available", events)
+	}
+	if got := c.Level(); got != Available {
+		t.Errorf("Level() = %v, want %v", got, Available)
+	}
+}
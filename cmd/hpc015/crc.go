@@ -0,0 +1,52 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+// crc print crc of frames, or verify crc at end of frames
+func crc(c *command, args []string) int {
+	verify := c.flags.Bool("verify", false, "verify crc at end of frame, instead of calculating")
+	if c.flags.Parse(args) != nil {
+		return 2
+	}
+	lines, err := c.lines()
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+
+	status := 0
+	for _, line := range lines {
+		frame, err := hex.DecodeString(line)
+		if err != nil {
+			status = c.errorf("failed to decode %q: %s", line, err.Error())
+			continue
+		}
+
+		if !*verify {
+			// crc, and frame with crc
+			crc := hpc015.Crc16(frame)
+			fmt.Fprintf(c.stdout, "%04X %X%04X\n", crc, frame, crc)
+			continue
+		}
+
+		switch {
+		case len(frame) < hpc015.Crc16Size:
+			status = c.errorf("%X is shorter than crc", frame)
+		case hpc015.Verify(frame):
+			fmt.Fprintf(c.stdout, "ok %X\n", frame)
+		default:
+			n := len(frame) - hpc015.Crc16Size
+			fmt.Fprintf(c.stdout, "incorrect %X, got %04X, want %04X\n", frame, binary.BigEndian.Uint16(frame[n:]), hpc015.Crc16(frame[:n]))
+			status = 1
+		}
+	}
+	return status
+}
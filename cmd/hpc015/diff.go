@@ -0,0 +1,100 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+// diff compare configuration read back from device, with configuration file
+func diff(c *command, args []string) int {
+	configPath := c.flags.String("config", "", "desired configuration file, such as examples/config.json")
+	tolerance := c.flags.Duration("tolerance", hpc015.DefaultTimeTolerance, "system time within tolerance is not different")
+	if c.flags.Parse(args) != nil {
+		return 2
+	}
+	if *configPath == "" || c.flags.NArg() > 1 {
+		c.flags.Usage()
+		return 2
+	}
+
+	desired, err := hpc015.LoadConfigFile(*configPath)
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+
+	lines, err := c.lines()
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+	if len(lines) != 1 {
+		return c.errorf("need one getsetting request, but %d lines given", len(lines))
+	}
+	setReq, _, err := parseSettingRequest(lines[0])
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+
+	differences := configurationDiff(*setReq.Configuration(), *desired, *tolerance)
+	if len(differences) == 0 {
+		fmt.Fprintln(c.stdout, "no difference")
+		return 0
+	}
+	for _, d := range differences {
+		fmt.Fprintln(c.stdout, d)
+	}
+	return 1
+}
+
+// configurationDiff returns description of every different field, such as:
+//
+//	Speed: device Low, desired High
+func configurationDiff(device, desired hpc015.Configuration, tolerance time.Duration) []string {
+	var differences []string
+	add := func(field string, device, desired interface{}) {
+		differences = append(differences, fmt.Sprintf("%s: device %v, desired %v", field, device, desired))
+	}
+	clock := func(t time.Time) string {
+		return t.Format("15:04")
+	}
+
+	if device.TimeVerifyMode != desired.TimeVerifyMode {
+		add("TimeVerifyMode", device.TimeVerifyMode, desired.TimeVerifyMode)
+	}
+	if device.Speed != desired.Speed {
+		add("Speed", device.Speed, desired.Speed)
+	}
+	if device.RecordingCycle != desired.RecordingCycle {
+		add("RecordingCycle", device.RecordingCycle, desired.RecordingCycle)
+	}
+	if device.UploadCycle != desired.UploadCycle {
+		add("UploadCycle", device.UploadCycle, desired.UploadCycle)
+	}
+	if device.EnableFixedTimeUpload != desired.EnableFixedTimeUpload {
+		add("EnableFixedTimeUpload", fmt.Sprintf("%04b", device.EnableFixedTimeUpload), fmt.Sprintf("%04b", desired.EnableFixedTimeUpload))
+	}
+	if desired.EnableFixedTimeUpload != 0 && clock(device.UploadClock) != clock(desired.UploadClock) {
+		add("UploadClock", clock(device.UploadClock), clock(desired.UploadClock))
+	}
+	if device.NetworkType != desired.NetworkType {
+		add("NetworkType", device.NetworkType, desired.NetworkType)
+	}
+	if device.DisplayType != desired.DisplayType {
+		add("DisplayType", device.DisplayType, desired.DisplayType)
+	}
+	if d := device.SystemTime.Sub(desired.SystemTime); d > tolerance || d < -tolerance {
+		const layout = "2006-01-02 15:04:05"
+		add("SystemTime", device.SystemTime.Format(layout), desired.SystemTime.Format(layout))
+	}
+	if clock(device.OpenClock) != clock(desired.OpenClock) {
+		add("OpenClock", clock(device.OpenClock), clock(desired.OpenClock))
+	}
+	if clock(device.CloseClock) != clock(desired.CloseClock) {
+		add("CloseClock", clock(device.CloseClock), clock(desired.CloseClock))
+	}
+	return differences
+}
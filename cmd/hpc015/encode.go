@@ -0,0 +1,122 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+// encode build response with configuration file
+func encode(c *command, args []string) int {
+	configPath := c.flags.String("config", "", "configuration file, such as examples/config.json")
+	request := c.flags.String("request", "", "getsetting request of device, response based on it")
+	flagHex := c.flags.String("flag", "", "flag of request in hex, default is flag of -request or current time")
+	cache := c.flags.Bool("cache", false, "build response of cache request, instead of getsetting")
+	answer := c.flags.String("answer", "ok", "answer of cache response, ok or failed")
+	if c.flags.Parse(args) != nil {
+		return 2
+	}
+	if *configPath == "" || c.flags.NArg() != 0 {
+		c.flags.Usage()
+		return 2
+	}
+
+	conf, err := hpc015.LoadConfigFile(*configPath)
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+
+	flag := hpc015.NewFlag(time.Now())
+	var setReq *hpc015.GetSettingRequest
+	if *request != "" {
+		setReq, flag, err = parseSettingRequest(*request)
+		if err != nil {
+			return c.errorf("%s", err.Error())
+		}
+	}
+	if *flagHex != "" {
+		if flag, err = parseFlag(*flagHex); err != nil {
+			return c.errorf("%s", err.Error())
+		}
+	}
+
+	var bin []byte
+	if *cache {
+		answerType := hpc015.OK
+		switch strings.ToLower(*answer) {
+		case "ok":
+		case "failed":
+			answerType = hpc015.Failed
+		default:
+			return c.errorf("unknown answer %q", *answer)
+		}
+		bin, err = (&hpc015.CacheRequest{}).Response(answerType, flag, *conf).Binary()
+	} else {
+		if setReq == nil {
+			// device of unknown configuration, every parameter is new
+			setReq = &hpc015.GetSettingRequest{
+				SerialNumber: make([]byte, 4),
+				MacAddress1:  make([]byte, 7),
+				MacAddress2:  make([]byte, 7),
+				MacAddress3:  make([]byte, 7),
+			}
+		}
+		setResp := setReq.Response(flag)
+		if _, err := setResp.SetConfiguration(*conf); err != nil {
+			return c.errorf("%s", err.Error())
+		}
+		bin, err = setResp.Binary()
+	}
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+
+	fmt.Fprintf(c.stdout, "result=%X\n", bin)
+	return 0
+}
+
+// parseSettingRequest parse getsetting request, from body or hex of data
+func parseSettingRequest(line string) (*hpc015.GetSettingRequest, uint16, error) {
+	line = strings.TrimSpace(line)
+	flag := hpc015.NewFlag(time.Now())
+
+	var data []byte
+	if i := strings.Index(line, "cmd="); i >= 0 {
+		schema, err := hpc015.NewRequestSchema(strings.Fields(line[i:])[0])
+		if err != nil {
+			return nil, 0, err
+		}
+		if schema.Cmd != "getsetting" {
+			return nil, 0, errors.New("not a getsetting request: " + schema.Cmd)
+		}
+		data, flag = schema.Data[0], schema.Flag
+	} else {
+		var err error
+		if data, err = hex.DecodeString(line); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode request: %s", err.Error())
+		}
+	}
+
+	setReq, err := hpc015.NewSettingRequest(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse SettingRequest: %w", err)
+	}
+	return setReq, flag, nil
+}
+
+// parseFlag parse hex of flag, such as `0002`
+func parseFlag(s string) (uint16, error) {
+	flag, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid flag %q", s)
+	}
+	return uint16(flag), nil
+}
@@ -0,0 +1,122 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command hpc015 decode and encode messages of hpc015, without writing Go.
+//
+// Usage:
+//
+//	hpc015 decode [line ...]
+//	hpc015 encode -config config.json [-request line] [-flag 0002] [-cache] [-answer failed]
+//	hpc015 crc [-verify] [hex ...]
+//	hpc015 diff -config config.json [-tolerance 5m] [line]
+//
+// Lines are read from standard input, if not given as arguments.
+// Line can be body of request or response, or hex of frame, and log of server can be pasted as it is.
+//
+// Exit status is 1 if something failed, crc is incorrect or configuration differs,
+// and 2 if usage is wrong.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+const usage = `usage:
+  hpc015 decode [line ...]
+  hpc015 encode -config config.json [-request line] [-flag 0002] [-cache] [-answer failed]
+  hpc015 crc [-verify] [hex ...]
+  hpc015 diff -config config.json [-tolerance 5m] [line]
+`
+
+func main() {
+	hpc015.EnableDebugMessage = false
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// command is context of a subcommand
+type command struct {
+	flags  *flag.FlagSet
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = map[string]func(c *command, args []string) int{
+	"decode": decode,
+	"encode": encode,
+	"crc":    crc,
+	"diff":   diff,
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	f, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "hpc015: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	c := &command{
+		flags:  flag.NewFlagSet(args[0], flag.ContinueOnError),
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	c.flags.SetOutput(stderr)
+	return f(c, args[1:])
+}
+
+// errorf print error, and returns exit status of failure
+func (c *command) errorf(format string, a ...interface{}) int {
+	fmt.Fprintf(c.stderr, "hpc015 %s: %s\n", c.flags.Name(), fmt.Sprintf(format, a...))
+	return 1
+}
+
+// lines returns arguments, or lines of stdin if there is no argument
+func (c *command) lines() ([]string, error) {
+	if c.flags.NArg() != 0 {
+		return c.flags.Args(), nil
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(c.stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// decode print every field of frames
+func decode(c *command, args []string) int {
+	if c.flags.Parse(args) != nil {
+		return 2
+	}
+	lines, err := c.lines()
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+
+	status := 0
+	for i, line := range lines {
+		if i != 0 {
+			fmt.Fprintln(c.stdout)
+		}
+		if err := hpc015.Dump(c.stdout, line); err != nil {
+			status = c.errorf("%s", err.Error())
+		}
+	}
+	return status
+}
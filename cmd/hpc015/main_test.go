@@ -0,0 +1,111 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+const (
+	testConfig         = "../../examples/config.json"
+	testSettingRequest = "cmd=getsetting&flag=0002&data=0D3BB382030000000000000000000000000002085DDD5A75CBDC0A5DDD5A75CBDC909F33173CE4DA0F0101000002010000173BECE4"
+	testCacheRequest   = "cmd=cache&flag=0002&status=010142AE51520156000D0001E6A7&count=2&data=15050D0D332A000100000000000000E97E&data=15050D0D332C000000000001000000C65E"
+)
+
+func init() {
+	hpc015.EnableDebugMessage = false
+}
+
+func runTest(args []string, stdin string) (int, string, string) {
+	var stdout, stderr strings.Builder
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		want       []string
+	}{
+		{"usage", nil, "", 2, nil},
+		{"unknown", []string{"unknown"}, "", 2, nil},
+		{"decode", []string{"decode", testSettingRequest}, "", 0, []string{"GetSettingRequest, 53 byte, crc ok"}},
+		{"decode stdin", []string{"decode"}, testCacheRequest + "\n\nresult=0102\n", 1, []string{"DeviceStatus", "CacheData"}},
+		{"crc", []string{"crc", "15050D0D332A000100000000000000"}, "", 0, []string{"E97E 15050D0D332A000100000000000000E97E"}},
+		{"crc verify", []string{"crc", "-verify"}, "15050D0D332A000100000000000000E97E\n", 0, []string{"ok"}},
+		{"crc incorrect", []string{"crc", "-verify", "15050D0D332A000100000000000000E97F"}, "", 1, []string{"want E97E"}},
+		{"crc invalid hex", []string{"crc", "XY"}, "", 1, nil},
+		{"encode without config", []string{"encode"}, "", 2, nil},
+		{"encode cache", []string{"encode", "-config", testConfig, "-cache", "-flag", "0002"}, "", 0, []string{"result="}},
+		{"encode unknown answer", []string{"encode", "-config", testConfig, "-cache", "-answer", "maybe"}, "", 1, nil},
+		{"diff", []string{"diff", "-config", testConfig, testSettingRequest}, "", 1, []string{
+			"TimeVerifyMode: device Both, desired Exclude",
+			"OpenClock: device 00:00, desired 09:00",
+		}},
+		{"diff cache request", []string{"diff", "-config", testConfig, testCacheRequest}, "", 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, stdout, stderr := runTest(tt.args, tt.stdin)
+			if status != tt.wantStatus {
+				t.Errorf("run() = %v, want %v, stderr: %s", status, tt.wantStatus, stderr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("run() output = %v, want contains %v", stdout, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	status, stdout, stderr := runTest([]string{"encode", "-config", testConfig, "-request", testSettingRequest}, "")
+	if status != 0 {
+		t.Fatalf("run() = %v, stderr: %s", status, stderr)
+	}
+
+	resp, err := hpc015.ParseGetSettingResponse(stdout)
+	if err != nil {
+		t.Fatalf("ParseGetSettingResponse() error = %v", err)
+	}
+	if resp.RespondingType != hpc015.NewParameterValue || resp.Flag != 0x0200 {
+		t.Errorf("response = %v %04X, want %v %04X", resp.RespondingType, resp.Flag, hpc015.NewParameterValue, 0x0200)
+	}
+	// based on request
+	if got := binary.BigEndian.Uint32(resp.SerialNumber); got != 0 {
+		t.Errorf("SerialNumber = %08X, want %08X", got, 0)
+	}
+	if resp.NetworkType != hpc015.StandAlone || resp.OpenHour != 9 || resp.CloseHour != 23 {
+		t.Errorf("response = %v, configuration not applied", resp)
+	}
+}
+
+func TestConfigurationDiff(t *testing.T) {
+	desired, err := hpc015.LoadConfigFile(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := *desired
+	if got := configurationDiff(device, *desired, time.Minute); len(got) != 0 {
+		t.Errorf("configurationDiff() = %v, want no difference", got)
+	}
+
+	device.SystemTime = device.SystemTime.Add(30 * time.Second)
+	device.Speed = hpc015.High
+	got := configurationDiff(device, *desired, time.Minute)
+	if len(got) != 1 || got[0] != "Speed: device High, desired Low" {
+		t.Errorf("configurationDiff() = %v, want only speed", got)
+	}
+}
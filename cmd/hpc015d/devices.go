@@ -0,0 +1,118 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+// defaultDevice is name of configuration file, for devices without own file
+const defaultDevice = "default"
+
+// deviceConfigs provide configuration of devices, loaded from directory.
+//
+// Files are form of examples/config.json, named by serial number such as `42AE5152.json`,
+// and `default.json` is used for devices without own file.
+// If neither exists, getsetting answered with device's own configuration,
+// and cache answered with configuration read back from device, see hpc015.Handler.Configuration.
+//
+// System time in files is ignored, current time is sent to devices.
+type deviceConfigs struct {
+	dir      string
+	configs  map[uint32]hpc015.Configuration
+	fallback *hpc015.Configuration
+	mux      *sync.Mutex
+}
+
+// newDeviceConfigs load configurations from `dir`, empty `dir` means no configuration.
+func newDeviceConfigs(dir string) (*deviceConfigs, error) {
+	d := &deviceConfigs{
+		dir:     dir,
+		configs: make(map[uint32]hpc015.Configuration),
+		mux:     &sync.Mutex{},
+	}
+	if err := d.Load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Load read files again. If any file is invalid, current configurations are kept.
+func (d *deviceConfigs) Load() error {
+	if d.dir == "" {
+		return nil
+	}
+
+	infos, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return fmt.Errorf("failed to load device configurations: %s", err.Error())
+	}
+
+	configs := make(map[uint32]hpc015.Configuration)
+	var fallback *hpc015.Configuration
+	for _, info := range infos {
+		name := strings.TrimSuffix(info.Name(), ".json")
+		if info.IsDir() || name == info.Name() {
+			continue
+		}
+
+		conf, err := hpc015.LoadConfigFile(filepath.Join(d.dir, info.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %s", info.Name(), err.Error())
+		}
+
+		if name == defaultDevice {
+			fallback = conf
+			continue
+		}
+		serialNumber, err := strconv.ParseUint(name, 16, 32)
+		if err != nil {
+			log.Printf("! ignore %s, name must be serial number or %s\n", info.Name(), defaultDevice)
+			continue
+		}
+		configs[uint32(serialNumber)] = *conf
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.configs = configs
+	d.fallback = fallback
+	return nil
+}
+
+// Configuration returns configuration of device, for hpc015.Handler.
+func (d *deviceConfigs) Configuration(serialNumber uint32) *hpc015.Configuration {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	conf, ok := d.configs[serialNumber]
+	if !ok {
+		if d.fallback == nil {
+			return nil
+		}
+		conf = *d.fallback
+	}
+	conf.SystemTime = time.Now()
+	return &conf
+}
+
+// Default returns default configuration, or hpc015.Default if there is no default.json.
+func (d *deviceConfigs) Default() hpc015.Configuration {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.fallback == nil {
+		return *hpc015.Default()
+	}
+	return *d.fallback
+}
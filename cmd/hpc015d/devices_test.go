@@ -0,0 +1,87 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+func TestDeviceConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hpc015d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	example, err := ioutil.ReadFile("../../examples/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// no file, device keep its own configuration
+	devices, err := newDeviceConfigs(dir)
+	if err != nil {
+		t.Fatalf("newDeviceConfigs() error = %v", err)
+	}
+	if got := devices.Configuration(0x42AE5152); got != nil {
+		t.Errorf("Configuration() = %v, want nil", got)
+	}
+	if got := devices.Default(); got.CloseClock.Hour() != 23 || got.CloseClock.Minute() != 59 {
+		t.Errorf("Default() = %v, want hpc015.Default()", got)
+	}
+
+	write("42AE5152.json", string(example))
+	write("default.json", strings.Replace(string(example), `"high-speed"`, `"low-speed"`, 1))
+	write("README.md", "not a configuration")
+	write("unknown.json", string(example))
+	if err := devices.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	got := devices.Configuration(0x42AE5152)
+	if got == nil || got.NetworkType != hpc015.StandAlone || got.OpenClock.Hour() != 9 {
+		t.Fatalf("Configuration() = %v, want from 42AE5152.json", got)
+	}
+	// system time of file ignored
+	if time.Since(got.SystemTime) > time.Minute {
+		t.Errorf("SystemTime = %v, want now", got.SystemTime)
+	}
+	if got := devices.Configuration(0x0D3BB382); got == nil {
+		t.Errorf("Configuration() = %v, want from default.json", got)
+	}
+	if got := devices.Default(); got.CloseClock.Hour() != 23 || got.CloseClock.Minute() != 0 {
+		t.Errorf("Default() = %v, want from default.json", got)
+	}
+
+	// invalid file, keep current
+	write("0D3BB382.json", `{"speed": "fast"}`)
+	if err := devices.Load(); err == nil {
+		t.Errorf("Load() error = %v, want error", err)
+	}
+	if got := devices.Configuration(0x42AE5152); got == nil {
+		t.Errorf("Configuration() = %v, want kept", got)
+	}
+
+	// no directory
+	if _, err := newDeviceConfigs(filepath.Join(dir, "none")); err == nil {
+		t.Errorf("newDeviceConfigs() error = %v, want error", err)
+	}
+	// no configuration
+	devices, err = newDeviceConfigs("")
+	if err != nil || devices.Configuration(0x42AE5152) != nil {
+		t.Errorf("newDeviceConfigs() = %v, %v, want no configuration", devices, err)
+	}
+}
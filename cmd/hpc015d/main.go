@@ -0,0 +1,329 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command hpc015d is server of hpc015.
+//
+// It persist every data to event log before answering device, count occupants,
+// and provide configuration to devices.
+//
+//	hpc015d -listen :8888 -path /cs -data-dir /var/lib/hpc015 -devices /etc/hpc015/devices
+//
+// Options can be written in file as JSON, with same names as flags, and given by `-config`.
+//
+// Endpoints, under path:
+//   - PATH: requests of devices
+//   - PATH/count: GET occupants, POST to correct occupants with `?reason=`,
+//     POST requires `Authorization: Bearer TOKEN` of `-admin-token`, and disabled without it
+//   - PATH/stream: occupancy updates, as Server-Sent Events
+//   - PATH/devices: last known status of devices
+//   - /metrics: metrics for Prometheus
+//
+// Log, and debug messages of `-debug`, are written to `-log-file`.
+//
+// Events persisted after counter flushed last, are replayed to counter on start.
+//
+// SIGHUP reload configurations of devices,
+// SIGINT and SIGTERM stop server, and after every request finished,
+// flush counter and close event log.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+// files in data directory
+const (
+	counterFile = "counter.json"
+	eventsFile  = "events.jsonl"
+	auditFile   = "corrections.jsonl"
+)
+
+func main() {
+	opts, err := loadOptions(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "hpc015d:", err.Error())
+		os.Exit(2)
+	}
+
+	listener, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		log.Fatal("! failed to listen: ", err.Error())
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	if err := run(opts, listener, sig); err != nil {
+		log.Fatal("! ", err.Error())
+	}
+}
+
+// run serve on `listener` until it closed, or stopped by `sig`.
+// `listener` is closed when run returns.
+func run(opts *options, listener net.Listener, sig <-chan os.Signal) error {
+	defer listener.Close()
+
+	if opts.LogFile != "" {
+		f, err := os.OpenFile(opts.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %s", err.Error())
+		}
+		defer f.Close()
+		log.SetOutput(f)
+	}
+	hpc015.EnableDebugMessage = opts.Debug
+	hpc015.DebugOutput = logWriter{}
+
+	devices, err := newDeviceConfigs(opts.Devices)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(opts.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %s", err.Error())
+	}
+	counter, err := hpc015.PersistentCounter(filepath.Join(opts.DataDir, counterFile), time.Minute)
+	if err != nil {
+		return fmt.Errorf("failed to restore counter: %s", err.Error())
+	}
+	defer func() {
+		if err := counter.Close(); err != nil {
+			log.Println("! failed to flush counter:", err.Error())
+		}
+	}()
+
+	store, err := hpc015.OpenFileStoreWithRetention(filepath.Join(opts.DataDir, eventsFile), opts.EventLogSize, time.Duration(opts.EventRetention))
+	if err != nil {
+		return fmt.Errorf("failed to open event store: %s", err.Error())
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Println("! failed to close event store:", err.Error())
+		}
+	}()
+
+	// events persisted but not flushed to counter, by crash
+	if saved := counter.Saved(); !saved.IsZero() {
+		events, err := store.ReceivedSince(saved.Add(-hpc015.ReplayMargin))
+		if err != nil {
+			return fmt.Errorf("failed to replay events: %s", err.Error())
+		}
+		if n := counter.Replay(events...); n != 0 {
+			log.Printf("- %d events replayed to counter\n", n)
+		}
+	}
+
+	audit, err := os.OpenFile(filepath.Join(opts.DataDir, auditFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %s", err.Error())
+	}
+	defer audit.Close()
+	counter.SetAuditLog(audit)
+
+	mode, _ := resetMode(opts.Reset)
+	counter.SetReset(mode, devices.Default())
+
+	metrics := hpc015.NewMetrics()
+	metrics.SetCounters(hpc015.Counters{"all": counter})
+	registry := hpc015.NewRegistry()
+	threshold := byte(opts.BatteryThreshold) // validated by loadOptions
+	handler := &hpc015.Handler{
+		Configuration: devices.Configuration,
+		Store:         store,
+		Counter:       counter,
+		Metrics:       metrics,
+		Registry:      registry,
+		Battery:       hpc015.NewBatteryMonitor(hpc015.BatteryThreshold{Transmitter: threshold, Counter: threshold}, 3, logBattery),
+		Focus:         hpc015.NewFocusMonitor(logFocus),
+	}
+	stream := hpc015.NewEventStream(hpc015.Counters{"all": counter})
+
+	mux := http.NewServeMux()
+	mux.Handle(opts.Path, handler)
+	mux.Handle(opts.Path+"/count", countHandler(counter, opts.AdminToken))
+	mux.Handle(opts.Path+"/stream", stream)
+	mux.Handle(opts.Path+"/devices", registry)
+	mux.Handle("/metrics", metrics)
+	handlers := &inflight{handler: mux, wg: &sync.WaitGroup{}}
+	server := &http.Server{Handler: handlers}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	detector := hpc015.NewOfflineDetector(registry, hpc015.DefaultTimeTolerance, time.Duration(opts.OfflineAfter), logDevice)
+	detector.Configuration = devices.Configuration
+	go detector.Run(ctx, time.Minute)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	log.Println("- server is running on:", listener.Addr().String()+opts.Path)
+
+	for {
+		select {
+		case err := <-served:
+			stream.Close()
+			handlers.wg.Wait()
+			return err
+
+		case s := <-sig:
+			if s == syscall.SIGHUP {
+				if err := devices.Load(); err != nil {
+					log.Println("! failed to reload devices:", err.Error())
+					continue
+				}
+				counter.SetReset(mode, devices.Default())
+				log.Println("- configurations of devices reloaded")
+				continue
+			}
+
+			log.Println("- shutting down by", s)
+			// stream never end by itself, disconnect before shutdown
+			stream.Close()
+			shutdown, done := context.WithTimeout(context.Background(), time.Duration(opts.ShutdownTimeout))
+			defer done()
+			if err := server.Shutdown(shutdown); err != nil {
+				log.Println("! failed to shutdown gracefully:", err.Error())
+				server.Close()
+			}
+			// handlers may still run after Close, store must not be closed under them
+			handlers.wg.Wait()
+			return nil
+		}
+	}
+}
+
+// resetMode returns ResetMode by its name in options
+func resetMode(name string) (hpc015.ResetMode, error) {
+	switch name {
+	case "open":
+		return hpc015.ResetAtOpen, nil
+	case "close":
+		return hpc015.ResetAtClose, nil
+	case "none":
+		return hpc015.NoReset, nil
+	}
+	return hpc015.NoReset, fmt.Errorf("reset must be open, close or none, but %q", name)
+}
+
+// inflight is http.Handler, which track requests being handled
+type inflight struct {
+	handler http.Handler
+	wg      *sync.WaitGroup
+}
+
+func (h *inflight) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.wg.Add(1)
+	defer h.wg.Done()
+	h.handler.ServeHTTP(w, req)
+}
+
+// logWriter write debug messages of library to log
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	log.Print(string(p))
+	return len(p), nil
+}
+
+// occupancy is counter, which handled by countHandler
+type occupancy interface {
+	GetOccupants() int
+	Correct(occupants int, who, why string) (hpc015.Correction, error)
+}
+
+// countHandler returns occupants on GET, and correct occupants on POST.
+//
+// POST requires `token` as bearer token, if `token` is empty, POST is disabled.
+func countHandler(counter occupancy, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch req.Method {
+		case http.MethodGet:
+			io.WriteString(w, strconv.Itoa(counter.GetOccupants()))
+
+		case http.MethodPost:
+			if token == "" {
+				http.Error(w, "correction disabled, run with admin token", http.StatusForbidden)
+				return
+			}
+			if !authorized(req, token) {
+				log.Println("! unauthorized correction from:", req.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			// correct occupants, in/out are kept
+			bin, err := ioutil.ReadAll(io.LimitReader(req.Body, 64))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			occupants, err := strconv.Atoi(string(bin))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			correction, err := counter.Correct(occupants, req.RemoteAddr, req.URL.Query().Get("reason"))
+			if err != nil {
+				log.Println("! failed to correct:", err.Error())
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("- occupants corrected by %s: %d -> %d\n", correction.Who, correction.Before, correction.After)
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// authorized returns whether request has bearer `token`
+func authorized(req *http.Request, token string) bool {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) == 1
+}
+
+func logBattery(alert hpc015.BatteryAlert) {
+	days := "unknown"
+	if alert.DaysRemaining >= 0 {
+		days = fmt.Sprintf("%.1f", alert.DaysRemaining)
+	}
+	log.Printf("! battery of %s %s is low: %d%%, days remaining: %s\n", hpc015.SerialString(alert.SerialNumber), alert.Battery, alert.Level, days)
+}
+
+func logFocus(event hpc015.FocusEvent) {
+	log.Printf("! focus of %s changed: %v -> %v\n", hpc015.SerialString(event.SerialNumber), event.Previous, event.Focus)
+}
+
+func logDevice(event hpc015.DeviceEvent) {
+	log.Printf("! device %s is %v, upload was due at %s\n", hpc015.SerialString(event.Device.SerialNumber), event.State, event.Due.Format(time.RFC3339))
+}
@@ -0,0 +1,184 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+const testCacheRequest = "cmd=cache&flag=0002&status=010142AE51520156000D0001E6A7&count=2&data=15050D0D332A000100000000000000E97E&data=15050D0D332C000000000001000000C65E"
+
+func TestRun(t *testing.T) {
+	defer func(output io.Writer) { hpc015.DebugOutput = output }(hpc015.DebugOutput)
+
+	opts := defaultOptions()
+	opts.DataDir = t.TempDir()
+	opts.Reset = "none"
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make(chan os.Signal, 1)
+	ran := make(chan error, 1)
+	go func() {
+		ran <- run(&opts, listener, sig)
+	}()
+
+	resp, err := http.Post("http://"+listener.Addr().String()+opts.Path, "application/x-www-form-urlencoded", strings.NewReader(testCacheRequest))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(string(body), "result=") {
+		t.Fatalf("Post() = %s, want prefix %s", body, "result=")
+	}
+
+	sig <- syscall.SIGTERM
+	select {
+	case err := <-ran:
+		if err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run() not returned after SIGTERM")
+	}
+
+	// counter flushed, and events persisted
+	bin, err := ioutil.ReadFile(filepath.Join(opts.DataDir, counterFile))
+	if err != nil {
+		t.Fatalf("counter not flushed: %v", err)
+	}
+	var snapshot struct {
+		In  int `json:"in"`
+		Out int `json:"out"`
+	}
+	if err := json.Unmarshal(bin, &snapshot); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if snapshot.In != 1 || snapshot.Out != 1 {
+		t.Errorf("snapshot = %+v, want in 1, out 1", snapshot)
+	}
+
+	events, err := hpc015.ReadEventLog(filepath.Join(opts.DataDir, eventsFile))
+	if err != nil {
+		t.Fatalf("ReadEventLog() error = %v", err)
+	}
+	if len(events) != 2 || events[0].SerialNumber != 0x42AE5152 {
+		t.Errorf("ReadEventLog() = %v, want 2 events of 42AE5152", events)
+	}
+}
+
+// fakeOccupancy record correction
+type fakeOccupancy struct {
+	occupants int
+	who, why  string
+	err       error
+}
+
+func (f *fakeOccupancy) GetOccupants() int {
+	return f.occupants
+}
+
+func (f *fakeOccupancy) Correct(occupants int, who, why string) (hpc015.Correction, error) {
+	if f.err != nil {
+		return hpc015.Correction{}, f.err
+	}
+	correction := hpc015.Correction{Who: who, Why: why, Before: f.occupants, After: occupants}
+	f.occupants, f.who, f.why = occupants, who, why
+	return correction, nil
+}
+
+func TestCountHandler(t *testing.T) {
+	counter := &fakeOccupancy{occupants: 3}
+	h := countHandler(counter, "secret")
+
+	auth := "Bearer secret"
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", auth)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodGet, "/cs/count", ""); rec.Body.String() != "3" {
+		t.Errorf("GET = %v, want %v", rec.Body.String(), "3")
+	}
+
+	if rec := serve(http.MethodPost, "/cs/count?reason=recount", "10"); rec.Code != http.StatusOK {
+		t.Errorf("POST = %v, want %v", rec.Code, http.StatusOK)
+	}
+	if counter.occupants != 10 || counter.why != "recount" {
+		t.Errorf("corrected = %v %q, want %v %q", counter.occupants, counter.why, 10, "recount")
+	}
+
+	if rec := serve(http.MethodPost, "/cs/count", "ten"); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST = %v, want %v", rec.Code, http.StatusBadRequest)
+	}
+
+	counter.err = errors.New("disk full")
+	if rec := serve(http.MethodPost, "/cs/count", "5"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("POST = %v, want %v", rec.Code, http.StatusInternalServerError)
+	}
+
+	if rec := serve(http.MethodDelete, "/cs/count", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE = %v, want %v", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	// without token
+	counter.err = nil
+	for _, auth = range []string{"", "secret", "Bearer wrong", "Basic c2VjcmV0"} {
+		if rec := serve(http.MethodPost, "/cs/count", "0"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST with %q = %v, want %v", auth, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if counter.occupants != 10 {
+		t.Errorf("occupants = %v, want %v", counter.occupants, 10)
+	}
+	if rec := serve(http.MethodGet, "/cs/count", ""); rec.Body.String() != "10" {
+		t.Errorf("GET = %v, want %v", rec.Body.String(), "10")
+	}
+
+	// token not configured
+	h = countHandler(counter, "")
+	auth = "Bearer "
+	if rec := serve(http.MethodPost, "/cs/count", "0"); rec.Code != http.StatusForbidden {
+		t.Errorf("POST = %v, want %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestResetMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    hpc015.ResetMode
+		wantErr bool
+	}{
+		{"open", hpc015.ResetAtOpen, false},
+		{"close", hpc015.ResetAtClose, false},
+		{"none", hpc015.NoReset, false},
+		{"noon", hpc015.NoReset, true},
+	}
+	for _, tt := range tests {
+		got, err := resetMode(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("resetMode(%q) = %v, %v, want %v, wantErr %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// options of daemon, given by flags or configuration file
+type options struct {
+	Listen           string   `json:"listen"`
+	Path             string   `json:"path"`
+	DataDir          string   `json:"data-dir"`
+	EventLogSize     int64    `json:"event-log-size"`
+	EventRetention   duration `json:"event-retention"`
+	Devices          string   `json:"devices"`
+	Reset            string   `json:"reset"`
+	AdminToken       string   `json:"admin-token"`
+	LogFile          string   `json:"log-file"`
+	Debug            bool     `json:"debug"`
+	BatteryThreshold int      `json:"battery-threshold"`
+	OfflineAfter     duration `json:"offline-after"`
+	ShutdownTimeout  duration `json:"shutdown-timeout"`
+}
+
+func defaultOptions() options {
+	return options{
+		Listen:           ":8888",
+		Path:             "/cs",
+		DataDir:          ".",
+		EventLogSize:     64 << 20,
+		EventRetention:   duration(7 * 24 * time.Hour),
+		Reset:            "open",
+		BatteryThreshold: 20,
+		OfflineAfter:     duration(time.Hour),
+		ShutdownTimeout:  duration(10 * time.Second),
+	}
+}
+
+// loadOptions parse flags, and configuration file given by `-config`.
+// Flags given explicitly take precedence over configuration file.
+func loadOptions(args []string, output io.Writer) (*options, error) {
+	opts := defaultOptions()
+
+	fs := flag.NewFlagSet("hpc015d", flag.ContinueOnError)
+	fs.SetOutput(output)
+	configPath := fs.String("config", "", "configuration file of daemon, in JSON with same names as flags")
+	fs.StringVar(&opts.Listen, "listen", opts.Listen, "address to listen")
+	fs.StringVar(&opts.Path, "path", opts.Path, "path configured on device, other endpoints are under it")
+	fs.StringVar(&opts.DataDir, "data-dir", opts.DataDir, "directory of counter snapshot, event log and audit log")
+	fs.Int64Var(&opts.EventLogSize, "event-log-size", opts.EventLogSize, "size in bytes to rotate event log")
+	fs.Var(&opts.EventRetention, "event-retention", "events of this long kept in memory, older events read from disk, 0 keeps all")
+	fs.StringVar(&opts.Devices, "devices", opts.Devices, "directory of device configurations, `SERIAL.json` and `default.json`")
+	fs.StringVar(&opts.Reset, "reset", opts.Reset, "reset occupancy every day at: open, close or none")
+	fs.StringVar(&opts.AdminToken, "admin-token", opts.AdminToken, "bearer token to correct occupants, correction disabled if empty. prefer -config, flag is visible to other users")
+	fs.StringVar(&opts.LogFile, "log-file", opts.LogFile, "file to append log, default is standard error")
+	fs.BoolVar(&opts.Debug, "debug", opts.Debug, "print every request and response")
+	fs.IntVar(&opts.BatteryThreshold, "battery-threshold", opts.BatteryThreshold, "percent of battery to alert, 0 disables")
+	fs.Var(&opts.OfflineAfter, "offline-after", "device not uploaded this long after due is offline")
+	fs.Var(&opts.ShutdownTimeout, "shutdown-timeout", "time to wait requests on shutdown")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if *configPath != "" {
+		bin, err := ioutil.ReadFile(*configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read configuration: %s", err.Error())
+		}
+		decoder := json.NewDecoder(bytes.NewReader(bin))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&opts); err != nil {
+			return nil, fmt.Errorf("failed to parse configuration: %s", err.Error())
+		}
+
+		// flags given explicitly overwrite file again
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if !strings.HasPrefix(opts.Path, "/") {
+		return nil, fmt.Errorf("path must start with /, but %q", opts.Path)
+	}
+	if _, err := resetMode(opts.Reset); err != nil {
+		return nil, err
+	}
+	if opts.BatteryThreshold < 0 || opts.BatteryThreshold > 100 {
+		return nil, fmt.Errorf("battery threshold must be 0 to 100, but %d", opts.BatteryThreshold)
+	}
+	return &opts, nil
+}
+
+// duration is time.Duration, written as `10s` in flag and file
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be string such as \"10s\": %s", err.Error())
+	}
+	return d.Set(s)
+}
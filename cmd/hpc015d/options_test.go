@@ -0,0 +1,88 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hpc015d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hpc015d.json")
+	if err := ioutil.WriteFile(path, []byte(`{"listen": ":9999", "data-dir": "/var/lib/hpc015", "reset": "close", "shutdown-timeout": "3s"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    func(o options) options
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: func(o options) options { return o },
+		},
+		{
+			name: "flags",
+			args: []string{"-listen", ":7777", "-offline-after", "30m", "-debug"},
+			want: func(o options) options {
+				o.Listen = ":7777"
+				o.OfflineAfter = duration(30 * time.Minute)
+				o.Debug = true
+				return o
+			},
+		},
+		{
+			name: "file, overwritten by flag",
+			args: []string{"-listen", ":7777", "-config", path},
+			want: func(o options) options {
+				o.Listen = ":7777"
+				o.DataDir = "/var/lib/hpc015"
+				o.Reset = "close"
+				o.ShutdownTimeout = duration(3 * time.Second)
+				return o
+			},
+		},
+		{name: "invalid reset", args: []string{"-reset", "noon"}, wantErr: true},
+		{name: "invalid path", args: []string{"-path", "cs"}, wantErr: true},
+		{name: "battery threshold over 100", args: []string{"-battery-threshold", "256"}, wantErr: true},
+		{name: "negative battery threshold", args: []string{"-battery-threshold", "-1"}, wantErr: true},
+		{name: "invalid duration", args: []string{"-shutdown-timeout", "10"}, wantErr: true},
+		{name: "unexpected argument", args: []string{"serve"}, wantErr: true},
+		{name: "no file", args: []string{"-config", filepath.Join(dir, "none.json")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadOptions(tt.args, ioutil.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := tt.want(defaultOptions()); *got != want {
+				t.Errorf("loadOptions() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+
+	// unknown field in file
+	if err := ioutil.WriteFile(path, []byte(`{"listem": ":9999"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadOptions([]string{"-config", path}, ioutil.Discard); err == nil {
+		t.Errorf("loadOptions() error = %v, want error for unknown field", err)
+	}
+}
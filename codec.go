@@ -0,0 +1,422 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Fixed-offset codec of frames.
+//
+// Encoders append frame into buffer given by caller, and decoders read fields by its offset,
+// so encoding and decoding does not use reflection, and allocate nothing if buffer is big enough.
+//
+//	buf := make([]byte, 0, GetSettingResponseSize)
+//	for ... {
+//		buf, err = response.AppendBinary(buf[:0])
+//	}
+
+// Length of frames, including crc.
+const (
+	GetSettingRequestSize  = 53
+	GetSettingResponseSize = 58
+	CacheDataSize          = 17
+	CacheResponseSize      = 17
+	DeviceStatusSize       = 14
+)
+
+// grow extend `b` by `n` bytes, returns extended `b` and extended part of it
+func grow(b []byte, n int) ([]byte, []byte) {
+	l := len(b)
+	if cap(b)-l < n {
+		nb := make([]byte, l, 2*cap(b)+n)
+		copy(nb, b)
+		b = nb
+	}
+	b = b[:l+n]
+	return b, b[l:]
+}
+
+// putCrc write crc of frame into last 2 bytes of frame
+func putCrc(frame []byte) {
+	binary.BigEndian.PutUint16(frame[len(frame)-2:], Crc16(frame[:len(frame)-2]))
+}
+
+// checkCrc verify crc in last 2 bytes of frame, and returns it
+func checkCrc(frame []byte) (uint16, error) {
+	if !Verify(frame) {
+		return 0, fmt.Errorf("failed to verify crc: %w", ErrInvalidCRC)
+	}
+	return binary.BigEndian.Uint16(frame[len(frame)-2:]), nil
+}
+
+// AppendBinary append data of getsetting request to `b`, with crc.
+//   - SerialNumber must be 4 byte, MacAddress 7 byte
+//   - Crc16 field is ignored, crc calculated again
+func (request GetSettingRequest) AppendBinary(b []byte) ([]byte, error) {
+	if len(request.SerialNumber) != 4 {
+		return b, errors.New("SerialNumber must be 4 byte")
+	}
+	if len(request.MacAddress1) != 7 || len(request.MacAddress2) != 7 || len(request.MacAddress3) != 7 {
+		return b, errors.New("MacAddress must be 7 byte")
+	}
+
+	b, f := grow(b, GetSettingRequestSize)
+	copy(f[0:4], request.SerialNumber)
+	f[4] = byte(request.TimeVerifyMode)
+	f[5] = byte(request.Speed)
+	f[6] = request.RecordingCycle
+	f[7] = request.UploadCycle
+	f[8] = request.FixedTimeUpload
+	f[9] = request.UploadHour1
+	f[10] = request.UploadMinute1
+	f[11] = request.UploadHour2
+	f[12] = request.UploadMinute2
+	f[13] = request.UploadHour3
+	f[14] = request.UploadMinute3
+	f[15] = request.UploadHour4
+	f[16] = request.UploadMinute4
+	f[17] = byte(request.NetworkType)
+	f[18] = byte(request.DisplayType)
+	copy(f[19:26], request.MacAddress1)
+	copy(f[26:33], request.MacAddress2)
+	copy(f[33:40], request.MacAddress3)
+	f[40] = request.Year
+	f[41] = request.Month
+	f[42] = request.Day
+	f[43] = request.Hour
+	f[44] = request.Minute
+	f[45] = request.Second
+	f[46] = request.Week
+	f[47] = request.OpenHour
+	f[48] = request.OpenMinute
+	f[49] = request.CloseHour
+	f[50] = request.CloseMinute
+	putCrc(f)
+	return b, nil
+}
+
+// decode read fields from `data`, slices of request refer `data`
+func (request *GetSettingRequest) decode(data []byte) error {
+	if len(data) != GetSettingRequestSize {
+		return fmt.Errorf("length must be 53 byte, but came %d byte", len(data))
+	}
+	crc, err := checkCrc(data)
+	if err != nil {
+		return err
+	}
+
+	*request = GetSettingRequest{
+		SerialNumber:    data[0:4],
+		TimeVerifyMode:  TimeVerifyMode(data[4]),
+		Speed:           Speed(data[5]),
+		RecordingCycle:  data[6],
+		UploadCycle:     data[7],
+		FixedTimeUpload: data[8],
+		UploadHour1:     data[9],
+		UploadMinute1:   data[10],
+		UploadHour2:     data[11],
+		UploadMinute2:   data[12],
+		UploadHour3:     data[13],
+		UploadMinute3:   data[14],
+		UploadHour4:     data[15],
+		UploadMinute4:   data[16],
+		NetworkType:     NetworkType(data[17]),
+		DisplayType:     DisplayType(data[18]),
+		MacAddress1:     data[19:26],
+		MacAddress2:     data[26:33],
+		MacAddress3:     data[33:40],
+		Year:            data[40],
+		Month:           data[41],
+		Day:             data[42],
+		Hour:            data[43],
+		Minute:          data[44],
+		Second:          data[45],
+		Week:            data[46],
+		OpenHour:        data[47],
+		OpenMinute:      data[48],
+		CloseHour:       data[49],
+		CloseMinute:     data[50],
+		Crc16:           crc,
+	}
+	return nil
+}
+
+// AppendBinary append getsetting response to `b`, with crc.
+//   - SerialNumber must be 4 byte, MacAddress 7 byte
+//   - Crc16 field is ignored, crc calculated again
+func (response GetSettingResponse) AppendBinary(b []byte) ([]byte, error) {
+	if len(response.SerialNumber) != 4 {
+		return b, errors.New("SerialNumber must be 4 byte")
+	}
+	if len(response.MacAddress1) != 7 || len(response.MacAddress2) != 7 || len(response.MacAddress3) != 7 {
+		return b, errors.New("MacAddress must be 7 byte")
+	}
+
+	b, f := grow(b, GetSettingResponseSize)
+	f[0] = byte(response.RespondingType)
+	binary.BigEndian.PutUint16(f[1:3], response.Flag)
+	copy(f[3:7], response.SerialNumber)
+	f[7] = byte(response.TimeVerifyMode)
+	f[8] = byte(response.Speed)
+	f[9] = response.RecordingCycle
+	f[10] = response.UploadCycle
+	f[11] = response.FixedTimeUpload
+	f[12] = response.UploadHour1
+	f[13] = response.UploadMinute1
+	f[14] = response.UploadHour2
+	f[15] = response.UploadMinute2
+	f[16] = response.UploadHour3
+	f[17] = response.UploadMinute3
+	f[18] = response.UploadHour4
+	f[19] = response.UploadMinute4
+	f[20] = byte(response.NetworkType)
+	f[21] = byte(response.DisplayType)
+	copy(f[22:29], response.MacAddress1)
+	copy(f[29:36], response.MacAddress2)
+	copy(f[36:43], response.MacAddress3)
+	f[43] = response.Year
+	f[44] = response.Month
+	f[45] = response.Day
+	f[46] = response.Hour
+	f[47] = response.Minute
+	f[48] = response.Second
+	f[49] = response.Week
+	f[50] = response.OpenHour
+	f[51] = response.OpenMinute
+	f[52] = response.CloseHour
+	f[53] = response.CloseMinute
+	f[54] = response.Reserved1
+	f[55] = response.Reserved2
+	putCrc(f)
+	return b, nil
+}
+
+// decode read fields from `data`, slices of response refer `data`
+func (response *GetSettingResponse) decode(data []byte) error {
+	if len(data) != GetSettingResponseSize {
+		return fmt.Errorf("failed to parse GetSettingResponse: length must be 58 byte, but came %d byte", len(data))
+	}
+	crc, err := checkCrc(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse GetSettingResponse: %w", err)
+	}
+
+	*response = GetSettingResponse{
+		RespondingType:  RespondingType(data[0]),
+		Flag:            binary.BigEndian.Uint16(data[1:3]),
+		SerialNumber:    data[3:7],
+		TimeVerifyMode:  TimeVerifyMode(data[7]),
+		Speed:           Speed(data[8]),
+		RecordingCycle:  data[9],
+		UploadCycle:     data[10],
+		FixedTimeUpload: data[11],
+		UploadHour1:     data[12],
+		UploadMinute1:   data[13],
+		UploadHour2:     data[14],
+		UploadMinute2:   data[15],
+		UploadHour3:     data[16],
+		UploadMinute3:   data[17],
+		UploadHour4:     data[18],
+		UploadMinute4:   data[19],
+		NetworkType:     NetworkType(data[20]),
+		DisplayType:     DisplayType(data[21]),
+		MacAddress1:     data[22:29],
+		MacAddress2:     data[29:36],
+		MacAddress3:     data[36:43],
+		Year:            data[43],
+		Month:           data[44],
+		Day:             data[45],
+		Hour:            data[46],
+		Minute:          data[47],
+		Second:          data[48],
+		Week:            data[49],
+		OpenHour:        data[50],
+		OpenMinute:      data[51],
+		CloseHour:       data[52],
+		CloseMinute:     data[53],
+		Reserved1:       data[54],
+		Reserved2:       data[55],
+		Crc16:           crc,
+	}
+	return nil
+}
+
+// AppendBinary append a data of cache request to `b`, with crc.
+//   - Crc16 field is ignored, crc calculated again
+func (data CacheData) AppendBinary(b []byte) ([]byte, error) {
+	b, f := grow(b, CacheDataSize)
+	f[0] = data.Year
+	f[1] = data.Month
+	f[2] = data.Day
+	f[3] = data.Hour
+	f[4] = data.Minute
+	f[5] = data.Secound
+	f[6] = byte(data.Focus)
+	binary.LittleEndian.PutUint32(f[7:11], data.DxIn)
+	binary.LittleEndian.PutUint32(f[11:15], data.Dxout)
+	putCrc(f)
+	return b, nil
+}
+
+// decode read fields from `bin`
+func (data *CacheData) decode(bin []byte) error {
+	if len(bin) != CacheDataSize {
+		return fmt.Errorf("failed to parse CacheData: length must be 17 byte, but came %d byte", len(bin))
+	}
+	crc, err := checkCrc(bin)
+	if err != nil {
+		return fmt.Errorf("failed to parse CacheData: %w", err)
+	}
+
+	*data = CacheData{
+		Year:    bin[0],
+		Month:   bin[1],
+		Day:     bin[2],
+		Hour:    bin[3],
+		Minute:  bin[4],
+		Secound: bin[5],
+		Focus:   Focus(bin[6]),
+		DxIn:    binary.LittleEndian.Uint32(bin[7:11]),
+		Dxout:   binary.LittleEndian.Uint32(bin[11:15]),
+		Crc16:   crc,
+	}
+	return nil
+}
+
+// AppendBinary append cache response to `b`, with crc.
+//   - Crc16 field is ignored, crc calculated again
+func (response CacheResponse) AppendBinary(b []byte) ([]byte, error) {
+	b, f := grow(b, CacheResponseSize)
+	f[0] = byte(response.AnswerType)
+	binary.BigEndian.PutUint16(f[1:3], response.Flag)
+	f[3] = byte(response.TimeVerifyMode)
+	f[4] = response.Year
+	f[5] = response.Month
+	f[6] = response.Day
+	f[7] = response.Hour
+	f[8] = response.Minute
+	f[9] = response.Second
+	f[10] = response.Week
+	f[11] = response.OpenHour
+	f[12] = response.OpenMinute
+	f[13] = response.CloseHour
+	f[14] = response.CloseMinute
+	putCrc(f)
+	return b, nil
+}
+
+// decode read fields from `data`
+func (response *CacheResponse) decode(data []byte) error {
+	if len(data) != CacheResponseSize {
+		return fmt.Errorf("failed to parse CacheResponse: length must be 17 byte, but came %d byte", len(data))
+	}
+	crc, err := checkCrc(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse CacheResponse: %w", err)
+	}
+
+	*response = CacheResponse{
+		AnswerType:     AnswerType(data[0]),
+		Flag:           binary.BigEndian.Uint16(data[1:3]),
+		TimeVerifyMode: TimeVerifyMode(data[3]),
+		Year:           data[4],
+		Month:          data[5],
+		Day:            data[6],
+		Hour:           data[7],
+		Minute:         data[8],
+		Second:         data[9],
+		Week:           data[10],
+		OpenHour:       data[11],
+		OpenMinute:     data[12],
+		CloseHour:      data[13],
+		CloseMinute:    data[14],
+		Crc16:          crc,
+	}
+	return nil
+}
+
+// AppendBinary append status of cache request to `b`.
+//   - Crc16 field written as it is, see DeviceStatus.Binary
+func (status DeviceStatus) AppendBinary(b []byte) ([]byte, error) {
+	b, f := grow(b, DeviceStatusSize)
+	binary.BigEndian.PutUint16(f[0:2], status.Version)
+	binary.BigEndian.PutUint32(f[2:6], status.SerialNumber)
+	f[6] = byte(status.Focus)
+	f[7] = status.TransmitterBAT
+	f[8] = status.Reserved_1
+	f[9] = status.CounterBAT
+	f[10] = byte(status.Charge)
+	f[11] = status.Reserved_2
+	binary.BigEndian.PutUint16(f[12:14], status.Crc16)
+	return b, nil
+}
+
+// decode read fields from `data`, crc is not verified
+func (status *DeviceStatus) decode(data []byte) error {
+	if len(data) != DeviceStatusSize {
+		return fmt.Errorf("failed to parse DeviceStatus: length must be 14 byte, but came %d byte", len(data))
+	}
+
+	*status = DeviceStatus{
+		Version:        binary.BigEndian.Uint16(data[0:2]),
+		SerialNumber:   binary.BigEndian.Uint32(data[2:6]),
+		Focus:          Focus(data[6]),
+		TransmitterBAT: data[7],
+		Reserved_1:     data[8],
+		CounterBAT:     data[9],
+		Charge:         Charge(data[10]),
+		Reserved_2:     data[11],
+		Crc16:          binary.BigEndian.Uint16(data[12:14]),
+	}
+	return nil
+}
+
+// decodeHex decode hex of status
+func (status *DeviceStatus) decodeHex(s string) error {
+	if len(s) != 2*DeviceStatusSize {
+		return fmt.Errorf("failed to parse DeviceStatus: length must be 14 byte, but came %d byte", len(s)/2)
+	}
+	var buf [DeviceStatusSize]byte
+	if err := decodeHexString(buf[:], s); err != nil {
+		return fmt.Errorf("failed to parse DeviceStatus: %s", err.Error())
+	}
+	return status.decode(buf[:])
+}
+
+// decodeHexString decode hex `s` into `dst`, same as hex.Decode but it takes string.
+// `dst` must be longer than half of `s`.
+func decodeHexString(dst []byte, s string) error {
+	if len(s)%2 == 1 {
+		return hex.ErrLength
+	}
+	for i := 0; i < len(s)/2; i++ {
+		hi, ok := fromHexChar(s[2*i])
+		if !ok {
+			return hex.InvalidByteError(s[2*i])
+		}
+		lo, ok := fromHexChar(s[2*i+1])
+		if !ok {
+			return hex.InvalidByteError(s[2*i+1])
+		}
+		dst[i] = hi<<4 | lo
+	}
+	return nil
+}
+
+// fromHexChar converts a hex character into its value
+func fromHexChar(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
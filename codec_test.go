@@ -0,0 +1,209 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testResponses(t testing.TB) (*GetSettingResponse, *CacheResponse) {
+	schema, err := NewRequestSchema(testSettingRequest)
+	if err != nil {
+		t.Fatalf("NewRequestSchema() error = %v", err)
+	}
+	setReq, err := NewSettingRequest(schema.Data[0])
+	if err != nil {
+		t.Fatalf("NewSettingRequest() error = %v", err)
+	}
+
+	schema, err = NewRequestSchema(testCacheRequest)
+	if err != nil {
+		t.Fatalf("NewRequestSchema() error = %v", err)
+	}
+	cacheReq, err := NewCacheRequest(schema)
+	if err != nil {
+		t.Fatalf("NewCacheRequest() error = %v", err)
+	}
+	return setReq.Response(schema.Flag), cacheReq.Response(OK, schema.Flag, *Default())
+}
+
+func TestAppendBinary(t *testing.T) {
+	setResp, cacheResp := testResponses(t)
+
+	// appended after existing bytes
+	prefix := []byte("result=")
+	got, err := setResp.AppendBinary(prefix)
+	if err != nil {
+		t.Fatalf("AppendBinary() error = %v", err)
+	}
+	want, _ := setResp.Binary()
+	if !bytes.Equal(got[:len(prefix)], prefix) || !bytes.Equal(got[len(prefix):], want) {
+		t.Errorf("AppendBinary() = %X, want %X after prefix", got, want)
+	}
+
+	// no allocation with enough buffer
+	buf := make([]byte, 0, GetSettingResponseSize)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = setResp.AppendBinary(buf[:0])
+		buf, _ = cacheResp.AppendBinary(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("AppendBinary() allocs = %v, want %v", allocs, 0)
+	}
+
+	// invalid length of slice
+	setResp.MacAddress2 = nil
+	if got, err := setResp.AppendBinary(prefix); err == nil || len(got) != len(prefix) {
+		t.Errorf("AppendBinary() = %X, %v, want error and untouched buffer", got, err)
+	}
+}
+
+func TestDecodeAllocs(t *testing.T) {
+	schema, err := NewRequestSchema(testCacheRequest)
+	if err != nil {
+		t.Fatalf("NewRequestSchema() error = %v", err)
+	}
+
+	var data CacheData
+	var status DeviceStatus
+	allocs := testing.AllocsPerRun(100, func() {
+		data.UnmarshalBinary(schema.Data[0])
+		status.decodeHex(schema.Status)
+	})
+	if allocs != 0 {
+		t.Errorf("decode allocs = %v, want %v", allocs, 0)
+	}
+}
+
+func TestNewRequestSchemaError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"short", "cmd=cache"},
+		{"flag", "cmd=getsetting&flag=02&data=0D3BB38203000000000000"},
+		{"data", "cmd=getsetting&flag=0002&data=0D3BB38203000000000000X"},
+		{"count", "cmd=cache&flag=0002&count=ZZ&data=0D3BB38203000000000000"},
+		{"no data", "cmd=getsetting&flag=0002&status=0D3BB38203000000000000"},
+		{"no cmd", "flag=0002&data=0D3BB382030000000000000000000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRequestSchema(tt.input); err == nil {
+				t.Errorf("NewRequestSchema() error = %v, want error", err)
+			}
+		})
+	}
+
+	// field without `=` is ignored
+	if _, err := NewRequestSchema("cmd=getsetting&tend&flag=0002&data=0D3BB382030000000000"); err != nil {
+		t.Errorf("NewRequestSchema() error = %v", err)
+	}
+}
+
+func BenchmarkNewRequestSchema(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		input string
+	}{
+		{"getsetting", testSettingRequest},
+		{"cache", testCacheRequest},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewRequestSchema(bm.input); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNewSettingRequest(b *testing.B) {
+	schema, err := NewRequestSchema(testSettingRequest)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewSettingRequest(schema.Data[0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewCacheRequest(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		schema, err := NewRequestSchema(testCacheRequest)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := NewCacheRequest(schema); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetSettingResponse(b *testing.B) {
+	setResp, _ := testResponses(b)
+
+	b.Run("Binary", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := setResp.Binary(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("AppendBinary", func(b *testing.B) {
+		buf := make([]byte, 0, GetSettingResponseSize)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var err error
+			if buf, err = setResp.AppendBinary(buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("UnmarshalBinary", func(b *testing.B) {
+		bin, _ := setResp.Binary()
+		var resp GetSettingResponse
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := resp.decode(bin); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCacheResponse(b *testing.B) {
+	_, cacheResp := testResponses(b)
+
+	b.Run("Binary", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := cacheResp.Binary(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("AppendBinary", func(b *testing.B) {
+		buf := make([]byte, 0, CacheResponseSize)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var err error
+			if buf, err = cacheResp.AppendBinary(buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
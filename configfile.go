@@ -0,0 +1,150 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// configFile is form of configuration file, see examples/config.json
+type configFile struct {
+	CommandType     string `json:"command-type"`
+	Speed           string `json:"speed"`
+	RecordingCycle  byte   `json:"recording-cycle"`
+	UploadingCycle  byte   `json:"uploading-cycle"`
+	FixedTimeUpload []struct {
+		Enable        bool `json:"enable"`
+		UploadHour    int  `json:"upload-hour"`
+		UploadMinutes int  `json:"upload-minutes"`
+	} `json:"fixed-time-upload"`
+	OperationMode string `json:"operation-mode"`
+	DisplayMode   string `json:"display-mode"`
+	SystemTime    string `json:"system-time"`
+	BusinessHour  struct {
+		OpenHour   string `json:"open-hour"`
+		ClosedHour string `json:"closed-hour"`
+	} `json:"business-hour"`
+}
+
+// values of configuration file
+var (
+	commandTypeValues = map[string]TimeVerifyMode{
+		"exclude-all":           Exclude,
+		"include-system-time":   System,
+		"include-business-hour": Business,
+		"include-all":           Both,
+	}
+	speedValues = map[string]Speed{
+		"low-speed":  Low,
+		"high-speed": High,
+	}
+	operationModeValues = map[string]NetworkType{
+		"online":      Online,
+		"stand-alone": StandAlone,
+	}
+	displayModeValues = map[string]DisplayType{
+		"none":           None,
+		"unidirectional": Unidirectinal,
+		"bilateral":      Bilateral,
+	}
+)
+
+// LoadConfigFile read configuration from file, such as examples/config.json.
+func LoadConfigFile(path string) (*Configuration, error) {
+	bin, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %s", err.Error())
+	}
+	return ParseConfigFile(bin)
+}
+
+// ParseConfigFile parse configuration file.
+//
+// Values of fields are:
+//   - command-type: exclude-all, include-system-time, include-business-hour, include-all
+//   - speed: low-speed, high-speed
+//   - operation-mode: online, stand-alone
+//   - display-mode: none, unidirectional, bilateral
+//   - system-time: `2006-01-02 15:04:05` in local time, empty or `now` for current time
+//   - business-hour: `15:04`
+//
+// Enabled entries of fixed-time-upload are set as bits of EnableFixedTimeUpload(first entry is lowest bit),
+// and first enabled entry is UploadClock, because Configuration has only one of it.
+func ParseConfigFile(bin []byte) (*Configuration, error) {
+	var file configFile
+	if err := json.Unmarshal(bin, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %s", err.Error())
+	}
+
+	conf := &Configuration{
+		RecordingCycle: file.RecordingCycle,
+		UploadCycle:    file.UploadingCycle,
+		UploadClock:    time.Date(1, 1, 1, 0, 0, 0, 0, time.Local),
+	}
+
+	var ok bool
+	if conf.TimeVerifyMode, ok = commandTypeValues[file.CommandType]; !ok {
+		return nil, fmt.Errorf("failed to parse configuration: unknown command-type %q", file.CommandType)
+	}
+	if conf.Speed, ok = speedValues[file.Speed]; !ok {
+		return nil, fmt.Errorf("failed to parse configuration: unknown speed %q", file.Speed)
+	}
+	if conf.NetworkType, ok = operationModeValues[file.OperationMode]; !ok {
+		return nil, fmt.Errorf("failed to parse configuration: unknown operation-mode %q", file.OperationMode)
+	}
+	if conf.DisplayType, ok = displayModeValues[file.DisplayMode]; !ok {
+		return nil, fmt.Errorf("failed to parse configuration: unknown display-mode %q", file.DisplayMode)
+	}
+
+	if len(file.FixedTimeUpload) > 4 {
+		return nil, fmt.Errorf("failed to parse configuration: fixed-time-upload can have 4 entries, but has %d", len(file.FixedTimeUpload))
+	}
+	for i := len(file.FixedTimeUpload) - 1; i >= 0; i-- {
+		upload := file.FixedTimeUpload[i]
+		if !upload.Enable {
+			continue
+		}
+		if upload.UploadHour < 0 || upload.UploadHour > 23 || upload.UploadMinutes < 0 || upload.UploadMinutes > 59 {
+			return nil, fmt.Errorf("failed to parse configuration: invalid fixed-time-upload %02d:%02d", upload.UploadHour, upload.UploadMinutes)
+		}
+		conf.EnableFixedTimeUpload |= 1 << uint(i)
+		conf.UploadClock = time.Date(1, 1, 1, upload.UploadHour, upload.UploadMinutes, 0, 0, time.Local)
+	}
+
+	switch file.SystemTime {
+	case "", "now":
+		conf.SystemTime = time.Now()
+	default:
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", file.SystemTime, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse configuration: invalid system-time: %s", err.Error())
+		}
+		conf.SystemTime = t
+	}
+
+	open, err := parseClock(file.BusinessHour.OpenHour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: invalid open-hour: %s", err.Error())
+	}
+	closed, err := parseClock(file.BusinessHour.ClosedHour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: invalid closed-hour: %s", err.Error())
+	}
+	conf.OpenClock = open
+	conf.CloseClock = closed
+
+	return conf, nil
+}
+
+// parseClock parse `15:04` as clock of Configuration
+func parseClock(s string) (time.Time, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(1, 1, 1, t.Hour(), t.Minute(), 0, 0, time.Local), nil
+}
@@ -0,0 +1,96 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	got, err := LoadConfigFile("examples/config.json")
+	if err != nil {
+		t.Fatalf("LoadConfigFile() error = %v", err)
+	}
+
+	want := Configuration{
+		TimeVerifyMode:        Exclude,
+		Speed:                 Low,
+		EnableFixedTimeUpload: 0x07,
+		UploadClock:           time.Date(1, 1, 1, 0, 0, 0, 0, time.Local),
+		NetworkType:           StandAlone,
+		DisplayType:           None,
+		SystemTime:            time.Date(2021, 6, 2, 9, 2, 58, 0, time.Local),
+		OpenClock:             time.Date(1, 1, 1, 9, 0, 0, 0, time.Local),
+		CloseClock:            time.Date(1, 1, 1, 23, 0, 0, 0, time.Local),
+	}
+	if *got != want {
+		t.Errorf("LoadConfigFile() = %v, want %v", *got, want)
+	}
+
+	if _, err := LoadConfigFile("examples/not-exist.json"); err == nil {
+		t.Errorf("LoadConfigFile() error = %v, want error", err)
+	}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	base := `{
+		"command-type": "include-all",
+		"speed": "high-speed",
+		"recording-cycle": 5,
+		"uploading-cycle": 10,
+		"fixed-time-upload": [
+			{"enable": false, "upload-hour": 1, "upload-minutes": 0},
+			{"enable": true, "upload-hour": 12, "upload-minutes": 30},
+			{"enable": true, "upload-hour": 18, "upload-minutes": 0}
+		],
+		"operation-mode": "online",
+		"display-mode": "bilateral",
+		"system-time": "now",
+		"business-hour": {"open-hour": "08:30", "closed-hour": "22:00"}
+	}`
+
+	got, err := ParseConfigFile([]byte(base))
+	if err != nil {
+		t.Fatalf("ParseConfigFile() error = %v", err)
+	}
+	if got.TimeVerifyMode != Both || got.Speed != High || got.RecordingCycle != 5 || got.UploadCycle != 10 {
+		t.Errorf("ParseConfigFile() = %v", got)
+	}
+	// second and third entry enabled, first enabled one is upload clock
+	if got.EnableFixedTimeUpload != 0x06 || got.UploadClock.Hour() != 12 || got.UploadClock.Minute() != 30 {
+		t.Errorf("ParseConfigFile() fixed time upload = %02X %v, want %02X 12:30", got.EnableFixedTimeUpload, got.UploadClock, 0x06)
+	}
+	if time.Since(got.SystemTime) > time.Minute {
+		t.Errorf("ParseConfigFile() SystemTime = %v, want now", got.SystemTime)
+	}
+	if got.OpenClock.Hour() != 8 || got.OpenClock.Minute() != 30 {
+		t.Errorf("ParseConfigFile() OpenClock = %v, want 08:30", got.OpenClock)
+	}
+
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		wantErr string
+	}{
+		{"command-type", `"include-all"`, `"all"`, "command-type"},
+		{"speed", `"high-speed"`, `"fast"`, "speed"},
+		{"operation-mode", `"online"`, `"offline"`, "operation-mode"},
+		{"display-mode", `"bilateral"`, `"both"`, "display-mode"},
+		{"system-time", `"now"`, `"yesterday"`, "system-time"},
+		{"open-hour", `"08:30"`, `"8 am"`, "open-hour"},
+		{"upload-hour", `"upload-hour": 18`, `"upload-hour": 24`, "fixed-time-upload"},
+		{"json", `{`, `[`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfigFile([]byte(strings.Replace(base, tt.old, tt.new, 1)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseConfigFile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxCorrections is number of Correction, kept by counter
+const maxCorrections = 1000
+
+// Correction is record of occupants corrected by hand.
+type Correction struct {
+	Time   time.Time `json:"time"`
+	Who    string    `json:"who"`
+	Why    string    `json:"why"`
+	Before int       `json:"before"` // occupants before correction
+	After  int       `json:"after"`  // occupants after correction
+}
+
+// SetAuditLog make counter write every Correction to `w`, as JSON line.
+func (c *counter) SetAuditLog(w io.Writer) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.auditLog = w
+}
+
+// Correct set current occupants as `occupants`, and record who and why.
+//
+// Unlike Set, in/out are kept for reporting,
+// difference is kept separately and added to GetOccupants until next reset.
+//
+// If writing audit log failed, counter is not corrected.
+func (c *counter) Correct(occupants int, who, why string) (Correction, error) {
+	c.mux.Lock()
+	defer c.unlock()
+
+	correction, err := c.correct(occupants, who, why)
+	if err != nil {
+		return correction, err
+	}
+	c.changed(correction.Time, CauseCorrection, 0, 0)
+	return correction, nil
+}
+
+// correct apply correction, caller must hold lock
+func (c *counter) correct(occupants int, who, why string) (Correction, error) {
+	correction := Correction{
+		Time:   time.Now(),
+		Who:    who,
+		Why:    why,
+		Before: c.occupants(),
+		After:  occupants,
+	}
+
+	if c.auditLog != nil {
+		line, err := json.Marshal(correction)
+		if err != nil {
+			return correction, fmt.Errorf("failed to write audit log: %s", err.Error())
+		}
+		if _, err := c.auditLog.Write(append(line, '\n')); err != nil {
+			return correction, fmt.Errorf("failed to write audit log: %s", err.Error())
+		}
+	}
+
+	if EnableDebugMessage {
+		fmt.Fprintf(DebugOutput, "- corrected by %s: %d -> %d (%s)\n", who, correction.Before, correction.After, why)
+	}
+
+	c.offset += correction.After - correction.Before
+	c.corrections = append(c.corrections, correction)
+	if len(c.corrections) > maxCorrections {
+		c.corrections = c.corrections[len(c.corrections)-maxCorrections:]
+	}
+	return correction, nil
+}
+
+// Corrections returns recent corrections, oldest first.
+func (c *counter) Corrections() []Correction {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return append([]Correction(nil), c.corrections...)
+}
@@ -1,8 +1,15 @@
 package hpc015
 
 import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
@@ -14,13 +21,41 @@ import (
 // Due to sometime hpc015 send duplicated data,
 // counter store recent data within 10 mins, and not count duplicated data.
 //
-// Use this just for a example,
-// it store all count in one variable, not compitable with multiple device.
+// To keep counts across restart, create with PersistentCounter.
+//
+// A counter store all count in one variable,
+// use one counter for each zone, or each device, to count separately.
 type counter struct {
 	in          int
 	out         int
 	eventBuffer map[string]*eventEntry
 	mux         *sync.Mutex
+
+	resetMode  ResetMode
+	resetClock time.Time    // hour and minute only
+	lastReset  time.Time    // start of current day
+	archive    []DailyTotal // totals of past days, oldest first
+
+	offset      int          // added to occupants by correction
+	corrections []Correction // oldest first
+	auditLog    io.Writer
+
+	driftPolicy DriftPolicy
+	drift       Drift
+	drifting    int // -1 if occupants is negative now, 1 if over capacity, otherwise 0
+
+	capacity         Capacity
+	capacityLevel    CapacityLevel
+	capacityCallback func(CapacityEvent)
+
+	pending []func() // called by unlock, after lock released
+
+	seq         uint64 // sequence of last Update
+	subscribers map[chan Update]struct{}
+
+	path  string        // snapshot file, empty if not persistent
+	saved time.Time     // when snapshot saved, which loaded or saved last
+	done  chan struct{} // closed by Close
 }
 
 // Counter create new counter
@@ -30,72 +65,355 @@ func Counter() *counter {
 	counter := &counter{
 		eventBuffer: make(map[string]*eventEntry),
 		mux:         &sync.Mutex{},
+		subscribers: make(map[chan Update]struct{}),
+		done:        make(chan struct{}),
 	}
 	go counter.clearTicker()
 
 	return counter
 }
 
+// PersistentCounter create new counter, which keep its state in file at `path`.
+//
+// If snapshot file exists, counter restored from it.
+// Events counted after snapshot flushed are lost by crash,
+// restore them from EventStore by Replay.
+// Snapshot flushed every `interval` and when Close called,
+// so counts and duplication buffer survive restart of server.
+// If `interval` is 0 or negative, snapshot flushed only when Close called.
+func PersistentCounter(path string, interval time.Duration) (*counter, error) {
+	counter := Counter()
+	counter.path = path
+
+	err := counter.Load(path)
+	if err != nil && !os.IsNotExist(err) {
+		counter.Close()
+		return nil, err
+	}
+
+	if interval > 0 {
+		go counter.flushTicker(interval)
+	}
+
+	return counter, nil
+}
+
 // Count a data
 // If data is duplicated, return nil, Otherwise return eventEntry.
+//
+// Data of several devices should be counted with CountFrom.
 func (c *counter) Count(data *CacheData) *eventEntry {
-	buf := make([]byte, 6, 6)
+	return c.CountFrom(0, data)
+}
+
+// CountFrom count a data, which sent by device of `serialNumber`.
+// Data of diffrent devices at same time are not treated as duplicated.
+// If data is duplicated, return nil, Otherwise return eventEntry.
+func (c *counter) CountFrom(serialNumber uint32, data *CacheData) *eventEntry {
+	buf := make([]byte, 10, 10)
 	buf[0] = data.Year
 	buf[1] = data.Month
 	buf[2] = data.Day
 	buf[3] = data.Hour
 	buf[4] = data.Minute
 	buf[5] = data.Secound
+	binary.BigEndian.PutUint32(buf[6:], serialNumber)
 
 	key := string(buf)
 	ee := &eventEntry{
 		time.Now(),
-		time.Date(int(data.Year)+2000, time.Month(data.Month), int(data.Day), int(data.Hour), int(data.Minute), int(data.Secound), 0, time.Local),
+		data.Time(),
 		int(data.DxIn),
 		int(data.Dxout),
 	}
 
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	_, ok := c.eventBuffer[key]
 	if ok {
 		if EnableDebugMessage {
-			fmt.Printf("- duplicated(%s)\n", ee.EventTime.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(DebugOutput, "- duplicated(%s)\n", ee.EventTime.Format("2006-01-02 15:04:05"))
 		}
 		return nil
 	}
 	if EnableDebugMessage {
-		fmt.Printf("- summary(%v): {in: %d, out: %d, current: %d}\n", ee.EventTime.Format("2006-01-02 15:04:05"), ee.DxIn, ee.DxOut, c.GetOccupants())
+		fmt.Fprintf(DebugOutput, "- summary(%v): {in: %d, out: %d, current: %d}\n", ee.EventTime.Format("2006-01-02 15:04:05"), ee.DxIn, ee.DxOut, c.occupants())
 	}
 	c.in += int(data.DxIn)
 	c.out += int(data.Dxout)
 	c.eventBuffer[key] = ee
+	c.checkDrift(ee.EventTime)
+	c.changed(ee.EventTime, CauseCount, ee.DxIn, ee.DxOut)
 	return ee
 }
 
-// GetOccupants current count
+// GetOccupants current count, including correction
+//
+// If DriftPolicy.Clamp is set, it never be negative or over capacity.
 func (c *counter) GetOccupants() int {
-	return c.in - c.out
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.clamp(c.occupants())
+}
+
+// occupants returns current count, caller must hold lock
+func (c *counter) occupants() int {
+	return c.in - c.out + c.offset
 }
 
-// GetInOut
+// GetInOut returns total of in/out, not affected by correction
 func (c *counter) GetInOut() (int, int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
 	return c.in, c.out
 }
 
-// Set current count
+// Set current count, corrections made before are discarded.
+//
+// Deprecated: Set overwrite in/out, use Correct to keep them.
 func (c *counter) Set(num int) {
+	c.mux.Lock()
+	defer c.unlock()
+
 	c.in = num
 	c.out = 0
+	c.offset = 0
+	c.changed(time.Now(), CauseSet, 0, 0)
+}
+
+// unlock release lock, then call pending functions,
+// so callbacks can use counter.
+func (c *counter) unlock() {
+	pending := c.pending
+	c.pending = nil
+	c.mux.Unlock()
+
+	for _, f := range pending {
+		f()
+	}
 }
 
-// clearTicker excute clear every 1 min
+// changed is called whenever occupants changed, caller must hold lock
+func (c *counter) changed(t time.Time, cause string, dxIn, dxOut int) {
+	c.checkCapacity(t)
+
+	c.seq++
+	c.publish(c.update(t, cause, dxIn, dxOut))
+}
+
+// update returns Update of current state, caller must hold lock
+func (c *counter) update(t time.Time, cause string, dxIn, dxOut int) Update {
+	return Update{
+		Seq:       c.seq,
+		Time:      t,
+		Cause:     cause,
+		DxIn:      dxIn,
+		DxOut:     dxOut,
+		In:        c.in,
+		Out:       c.out,
+		Occupants: c.clamp(c.occupants()),
+		Level:     c.capacityLevel,
+	}
+}
+
+// state returns current state as Update of CauseSnapshot, with Seq of last Update
+func (c *counter) state() Update {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.update(time.Now(), CauseSnapshot, 0, 0)
+}
+
+// clearTicker excute clear and reset every 1 min
 func (c *counter) clearTicker() {
 	t := time.NewTicker(time.Duration(time.Minute))
-	for range t.C {
-		c.clear()
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			c.clear()
+			c.checkReset(now)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// flushTicker excute Flush every `interval`
+func (c *counter) flushTicker(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := c.Flush(); err != nil && EnableDebugMessage {
+				fmt.Fprintf(DebugOutput, "- failed to flush counter: %s\n", err.Error())
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Flush write snapshot to file, which given to PersistentCounter.
+// It does nothing if counter is not persistent.
+func (c *counter) Flush() error {
+	if c.path == "" {
+		return nil
+	}
+	return c.Save(c.path)
+}
+
+// Close stop go routines of counter, close channels of subscribers, and flush snapshot at last.
+// Counter still can count after closed, but it will not be flushed anymore.
+func (c *counter) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+		close(c.done)
+	}
+	return c.Flush()
+}
+
+// counterSnapshot is form of counter, written in file
+type counterSnapshot struct {
+	In          int                    `json:"in"`
+	Out         int                    `json:"out"`
+	Events      map[string]*eventEntry `json:"events"` // key is hex encoded
+	LastReset   time.Time              `json:"last_reset"`
+	Archive     []DailyTotal           `json:"archive"`
+	Offset      int                    `json:"offset"`
+	Corrections []Correction           `json:"corrections"`
+	Drift       Drift                  `json:"drift"`
+	Saved       time.Time              `json:"saved"`
+}
+
+// Save write counts and duplication buffer into file.
+//
+// File written to temporary file first, then renamed,
+// so file at `path` is never be broken by crash while writing.
+func (c *counter) Save(path string) error {
+	c.mux.Lock()
+	snapshot := counterSnapshot{
+		In:          c.in,
+		Out:         c.out,
+		Events:      make(map[string]*eventEntry, len(c.eventBuffer)),
+		LastReset:   c.lastReset,
+		Archive:     append([]DailyTotal(nil), c.archive...),
+		Offset:      c.offset,
+		Corrections: append([]Correction(nil), c.corrections...),
+		Drift:       c.drift,
+		Saved:       time.Now(),
+	}
+	for k, e := range c.eventBuffer {
+		entry := *e
+		snapshot.Events[hex.EncodeToString([]byte(k))] = &entry
+	}
+	c.mux.Unlock()
+
+	bin, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to save counter: %s", err.Error())
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save counter: %s", err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save counter: %s", err.Error())
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save counter: %s", err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save counter: %s", err.Error())
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	c.saved = snapshot.Saved
+	c.mux.Unlock()
+	return nil
+}
+
+// Load restore counts and duplication buffer from file, written by Save.
+//
+// If file not exist, returned error satisfy os.IsNotExist.
+func (c *counter) Load(path string) error {
+	bin, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var snapshot counterSnapshot
+	if err := json.Unmarshal(bin, &snapshot); err != nil {
+		return fmt.Errorf("failed to load counter: %s", err.Error())
+	}
+
+	eventBuffer := make(map[string]*eventEntry, len(snapshot.Events))
+	for k, e := range snapshot.Events {
+		key, err := hex.DecodeString(k)
+		if err != nil {
+			return fmt.Errorf("failed to load counter: %s", err.Error())
+		}
+		eventBuffer[string(key)] = e
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.in = snapshot.In
+	c.out = snapshot.Out
+	c.eventBuffer = eventBuffer
+	c.lastReset = snapshot.LastReset
+	c.archive = snapshot.Archive
+	c.offset = snapshot.Offset
+	c.corrections = snapshot.Corrections
+	c.drift = snapshot.Drift
+	c.saved = snapshot.Saved
+	return nil
+}
+
+// Saved returns when snapshot saved, which loaded or saved last.
+// It is zero if there is no snapshot.
+func (c *counter) Saved() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.saved
+}
+
+// ReplayMargin is added before Saved, to find events to Replay.
+//
+// Event received just before snapshot saved, can be counted after it.
+// It must be shorter than 10 mins, duplication buffer of counter.
+const ReplayMargin = time.Minute
+
+// Replay count events, which persisted but lost from counter by crash,
+// and returns number of events counted.
+//
+// Give it events received since Saved() - ReplayMargin.
+// Events already counted are in duplication buffer of snapshot, so not counted twice.
+func (c *counter) Replay(events ...Event) int {
+	counted := 0
+	for _, e := range events {
+		if c.CountFrom(e.SerialNumber, e.data()) != nil {
+			counted++
+		}
 	}
+	return counted
 }
 
 // clear events older than 10 mins
@@ -114,7 +432,7 @@ func (c *counter) clear() {
 	}
 
 	if EnableDebugMessage && deletedEntry != 0 {
-		fmt.Printf("- clear: %d deleted, %d remains\n", deletedEntry, len(c.eventBuffer))
+		fmt.Fprintf(DebugOutput, "- clear: %d deleted, %d remains\n", deletedEntry, len(c.eventBuffer))
 	}
 }
 
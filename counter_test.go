@@ -0,0 +1,279 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounterSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.json")
+
+	c := Counter()
+	defer c.Close()
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 3})
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 44, Dxout: 1})
+
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	restored := Counter()
+	defer restored.Close()
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if in, out := restored.GetInOut(); in != 3 || out != 1 {
+		t.Errorf("GetInOut() = %d, %d, want %d, %d", in, out, 3, 1)
+	}
+
+	// resent data must be treated as duplicated after restored
+	if ee := restored.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 3}); ee != nil {
+		t.Errorf("Count() = %v, want nil", ee)
+	}
+}
+
+func TestPersistentCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.json")
+
+	c, err := PersistentCounter(path, time.Hour)
+	if err != nil {
+		t.Fatalf("PersistentCounter() error = %v", err)
+	}
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 2})
+
+	// flushed on close
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+
+	c, err = PersistentCounter(path, time.Hour)
+	if err != nil {
+		t.Fatalf("PersistentCounter() error = %v", err)
+	}
+	defer c.Close()
+
+	if got := c.GetOccupants(); got != 2 {
+		t.Errorf("GetOccupants() = %d, want %d", got, 2)
+	}
+}
+
+func TestPersistentCounterNoInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.json")
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		c, err := PersistentCounter(path, interval)
+		if err != nil {
+			t.Fatalf("PersistentCounter(%v) error = %v", interval, err)
+		}
+		c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 2})
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	c, err := PersistentCounter(path, 0)
+	if err != nil {
+		t.Fatalf("PersistentCounter() error = %v", err)
+	}
+	defer c.Close()
+	if got := c.GetOccupants(); got != 2 {
+		t.Errorf("GetOccupants() = %d, want %d", got, 2)
+	}
+}
+
+func TestCounterReset(t *testing.T) {
+	c := Counter()
+	defer c.Close()
+
+	conf := Default()
+	conf.OpenClock = time.Date(1, 1, 1, 9, 0, 0, 0, time.Local)
+	c.SetReset(ResetAtOpen, *conf)
+
+	next := c.NextReset()
+	if next.Hour() != 9 || next.Minute() != 0 || !next.After(time.Now()) {
+		t.Errorf("NextReset() = %v, want next 09:00", next)
+	}
+
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 3})
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 44, Dxout: 1})
+
+	// not reset before open time
+	c.checkReset(next.Add(-time.Minute))
+	if got := c.GetOccupants(); got != 2 {
+		t.Errorf("GetOccupants() = %d, want %d", got, 2)
+	}
+
+	c.checkReset(next.Add(time.Minute))
+	if in, out := c.GetInOut(); in != 0 || out != 0 {
+		t.Errorf("GetInOut() = %d, %d, want %d, %d", in, out, 0, 0)
+	}
+
+	totals := c.DailyTotals()
+	if len(totals) != 1 || totals[0].In != 3 || totals[0].Out != 1 || totals[0].Occupants != 2 {
+		t.Errorf("DailyTotals() = %v, want one total of {in: 3, out: 1}", totals)
+	}
+
+	// reset only once a day
+	c.checkReset(next.Add(2 * time.Minute))
+	if got := len(c.DailyTotals()); got != 1 {
+		t.Errorf("len(DailyTotals()) = %d, want %d", got, 1)
+	}
+}
+
+func TestCounterCorrect(t *testing.T) {
+	c := Counter()
+	defer c.Close()
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 3})
+
+	var audit bytes.Buffer
+	c.SetAuditLog(&audit)
+
+	correction, err := c.Correct(1, "manager", "two people left by emergency exit")
+	if err != nil {
+		t.Fatalf("Correct() error = %v", err)
+	}
+	if correction.Before != 3 || correction.After != 1 {
+		t.Errorf("Correct() = %v, want 3 -> 1", correction)
+	}
+	if got := c.GetOccupants(); got != 1 {
+		t.Errorf("GetOccupants() = %d, want %d", got, 1)
+	}
+	if in, out := c.GetInOut(); in != 3 || out != 0 {
+		t.Errorf("GetInOut() = %d, %d, want %d, %d", in, out, 3, 0)
+	}
+
+	// correction kept, while counting
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 44, DxIn: 2})
+	if got := c.GetOccupants(); got != 3 {
+		t.Errorf("GetOccupants() = %d, want %d", got, 3)
+	}
+
+	if !strings.Contains(audit.String(), `"who":"manager"`) {
+		t.Errorf("audit log = %s, want record of manager", audit.String())
+	}
+	if got := c.Corrections(); len(got) != 1 || got[0].Who != "manager" {
+		t.Errorf("Corrections() = %v, want one correction", got)
+	}
+
+	// Set overwrite correction too
+	c.Set(7)
+	if got := c.GetOccupants(); got != 7 {
+		t.Errorf("GetOccupants() after Set = %d, want %d", got, 7)
+	}
+}
+
+func TestCounterDrift(t *testing.T) {
+	count := func(c *counter, second byte, in, out uint32) {
+		c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: second, DxIn: in, Dxout: out})
+	}
+
+	t.Run("clamp", func(t *testing.T) {
+		c := Counter()
+		defer c.Close()
+		c.SetDriftPolicy(DriftPolicy{Clamp: true})
+		c.SetCapacity(Capacity{Full: 5}, nil)
+
+		count(c, 1, 0, 2)
+		if got := c.GetOccupants(); got != 0 {
+			t.Errorf("GetOccupants() = %d, want %d", got, 0)
+		}
+		count(c, 2, 0, 1)
+		count(c, 3, 10, 0)
+		if got := c.GetOccupants(); got != 5 {
+			t.Errorf("GetOccupants() = %d, want %d", got, 5)
+		}
+		// same capacity as clamped
+		if got := c.Level(); got != Full {
+			t.Errorf("Level() = %v, want %v", got, Full)
+		}
+
+		want := Drift{Negative: 1, MaxNegative: 3, OverCapacity: 1, MaxOver: 2}
+		got := c.Drift()
+		got.Last = time.Time{}
+		if got != want {
+			t.Errorf("Drift() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("auto correct", func(t *testing.T) {
+		c := Counter()
+		defer c.Close()
+		c.SetDriftPolicy(DriftPolicy{AutoCorrect: true})
+
+		count(c, 1, 0, 2)
+		count(c, 2, 1, 0)
+		if got := c.GetOccupants(); got != 1 {
+			t.Errorf("GetOccupants() = %d, want %d", got, 1)
+		}
+		if got := c.Corrections(); len(got) != 1 || got[0].Who != "auto" {
+			t.Errorf("Corrections() = %v, want one auto correction", got)
+		}
+		if in, out := c.GetInOut(); in != 1 || out != 2 {
+			t.Errorf("GetInOut() = %d, %d, want %d, %d", in, out, 1, 2)
+		}
+	})
+}
+
+func TestCounterReplay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "counter.json")
+	store, err := OpenFileStore(filepath.Join(dir, "events.jsonl"), 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	defer store.Close()
+
+	persist := func(c *counter, e Event) {
+		if err := store.Append(e); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		if c != nil {
+			c.CountFrom(e.SerialNumber, e.data())
+		}
+	}
+
+	c, err := PersistentCounter(path, 0)
+	if err != nil {
+		t.Fatalf("PersistentCounter() error = %v", err)
+	}
+	persist(c, testEvent(1, 42, 3, 0))
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	// persisted, but crashed before counted and flushed
+	persist(nil, testEvent(1, 43, 0, 1))
+	persist(nil, testEvent(2, 43, 2, 0))
+	close(c.done)
+
+	c, err = PersistentCounter(path, 0)
+	if err != nil {
+		t.Fatalf("PersistentCounter() error = %v", err)
+	}
+	defer c.Close()
+	if c.Saved().IsZero() {
+		t.Fatalf("Saved() = %v, want time of flush", c.Saved())
+	}
+
+	events, err := store.ReceivedSince(c.Saved().Add(-ReplayMargin))
+	if err != nil {
+		t.Fatalf("ReceivedSince() error = %v", err)
+	}
+	// first event is counted already
+	if got := c.Replay(events...); got != 2 {
+		t.Errorf("Replay() = %d, want %d", got, 2)
+	}
+	if in, out := c.GetInOut(); in != 5 || out != 1 {
+		t.Errorf("GetInOut() = %d, %d, want %d, %d", in, out, 5, 1)
+	}
+}
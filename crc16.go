@@ -0,0 +1,88 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import "hash"
+
+// Crc16Size is size of CRC16 checksum in bytes.
+const Crc16Size = 2
+
+// crc16Table is table of Modbus CRC16(reflected polynomial 0xA001)
+var crc16Table = makeCrc16Table()
+
+func makeCrc16Table() *[256]uint16 {
+	table := new([256]uint16)
+	for i := range table {
+		crc := uint16(i)
+		for j := 0; j < 8; j++ {
+			if crc&0x01 == 1 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// updateCrc16 returns `crc` updated with `data`
+func updateCrc16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc = crc>>8 ^ crc16Table[byte(crc)^b]
+	}
+	return crc
+}
+
+// Crc16 returns CRC16 of data, Modbus variant used by hpc015.
+//
+// On frame, it written as BigEndian(high byte first), after data.
+func Crc16(data []byte) uint16 {
+	return updateCrc16(0xFFFF, data)
+}
+
+// Verify reports whether last 2 bytes of frame is CRC16 of rest of frame.
+func Verify(frame []byte) bool {
+	if len(frame) < Crc16Size {
+		return false
+	}
+	n := len(frame) - Crc16Size
+	return Crc16(frame[:n]) == uint16(frame[n])<<8|uint16(frame[n+1])
+}
+
+// Hash16 is the common interface implemented by 16-bit hash functions.
+type Hash16 interface {
+	hash.Hash
+	Sum16() uint16
+}
+
+// NewCrc16 returns hash of Crc16, to calculate crc of data written in several times.
+//
+// Sum append crc in same order as written on frame.
+func NewCrc16() Hash16 {
+	d := new(crc16Digest)
+	d.Reset()
+	return d
+}
+
+type crc16Digest struct {
+	crc uint16
+}
+
+func (d *crc16Digest) Write(p []byte) (int, error) {
+	d.crc = updateCrc16(d.crc, p)
+	return len(p), nil
+}
+
+func (d *crc16Digest) Sum(b []byte) []byte {
+	return append(b, byte(d.crc>>8), byte(d.crc))
+}
+
+func (d *crc16Digest) Sum16() uint16 { return d.crc }
+
+func (d *crc16Digest) Reset() { d.crc = 0xFFFF }
+
+func (d *crc16Digest) Size() int { return Crc16Size }
+
+func (d *crc16Digest) BlockSize() int { return 1 }
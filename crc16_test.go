@@ -0,0 +1,105 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/hex"
+	"testing"
+	"testing/quick"
+)
+
+// bitwiseCrc16 is Modbus CRC16 calculated bit by bit
+func bitwiseCrc16(data []byte) uint16 {
+	var crc uint16 = 0xFFFF
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&0x01 == 1 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+func TestCrc16(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want uint16
+	}{
+		{"check value", hex.EncodeToString([]byte("123456789")), 0x4B37},
+		{"empty", "", 0xFFFF},
+		{"CacheData", "15050D0D332A000100000000000000", 0xE97E},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.data)
+			if got := Crc16(data); got != tt.want {
+				t.Errorf("Crc16() = %04X, want %04X", got, tt.want)
+			}
+		})
+	}
+
+	// same as bitwise, regardless of length
+	if err := quick.Check(func(data []byte) bool {
+		return Crc16(data) == bitwiseCrc16(data)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	long := make([]byte, 1024)
+	if got, want := Crc16(long), bitwiseCrc16(long); got != want {
+		t.Errorf("Crc16() = %04X, want %04X", got, want)
+	}
+}
+
+func TestNewCrc16(t *testing.T) {
+	if err := quick.Check(func(a, b []byte) bool {
+		h := NewCrc16()
+		h.Write(a)
+		h.Write(b)
+		want := Crc16(append(append([]byte(nil), a...), b...))
+		sum := h.Sum([]byte{0xAA})
+		return h.Sum16() == want &&
+			len(sum) == 3 && sum[0] == 0xAA && uint16(sum[1])<<8|uint16(sum[2]) == want
+	}, nil); err != nil {
+		t.Error(err)
+	}
+
+	h := NewCrc16()
+	h.Write([]byte("123456789"))
+	h.Reset()
+	if got := h.Sum16(); got != 0xFFFF {
+		t.Errorf("Sum16() after Reset() = %04X, want %04X", got, 0xFFFF)
+	}
+	if h.Size() != Crc16Size || h.BlockSize() != 1 {
+		t.Errorf("Size(), BlockSize() = %v, %v, want %v, %v", h.Size(), h.BlockSize(), Crc16Size, 1)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	frame, _ := hex.DecodeString("15050D0D332A000100000000000000E97E")
+	if !Verify(frame) {
+		t.Errorf("Verify(%X) = false, want true", frame)
+	}
+
+	frame[7] = 2
+	if Verify(frame) {
+		t.Errorf("Verify(%X) = true, want false", frame)
+	}
+	if Verify([]byte{0xFF}) {
+		t.Errorf("Verify() = true, want false for 1 byte")
+	}
+}
+
+func BenchmarkCrc16(b *testing.B) {
+	data := make([]byte, GetSettingResponseSize-Crc16Size)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		Crc16(data)
+	}
+}
@@ -0,0 +1,69 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Decoders of responses, which sent by server.
+// They are useful to verify responses, and to debug captured traffic.
+
+// ParseGetSettingResponse parse body of getsetting response, such as:
+//
+//	result=0502000000000003...
+//
+// Prefix `result=` can be omitted.
+func ParseGetSettingResponse(body string) (*GetSettingResponse, error) {
+	data, err := decodeResult(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GetSettingResponse: %s", err.Error())
+	}
+	return NewGetSettingResponse(data)
+}
+
+// NewGetSettingResponse makes GetSettingResponse from binary.
+//
+//   - Length of [data] must be 58
+//   - This function vaild CRC16
+func NewGetSettingResponse(data []byte) (*GetSettingResponse, error) {
+	response := new(GetSettingResponse)
+	if err := response.decode(data); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ParseCacheResponse parse body of cache response, such as:
+//
+//	result=0102000000000000...
+//
+// Prefix `result=` can be omitted.
+func ParseCacheResponse(body string) (*CacheResponse, error) {
+	data, err := decodeResult(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CacheResponse: %s", err.Error())
+	}
+	return NewCacheResponse(data)
+}
+
+// NewCacheResponse makes CacheResponse from binary.
+//
+//   - Length of [data] must be 17
+//   - This function vaild CRC16
+func NewCacheResponse(data []byte) (*CacheResponse, error) {
+	response := new(CacheResponse)
+	if err := response.decode(data); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// decodeResult decode hex of response body, with or without `result=`
+func decodeResult(body string) ([]byte, error) {
+	body = strings.TrimPrefix(strings.TrimSpace(body), "result=")
+	return hex.DecodeString(body)
+}
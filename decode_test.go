@@ -0,0 +1,99 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGetSettingResponse(t *testing.T) {
+	conf := *Default()
+	conf.Speed = High
+	conf.UploadCycle = 10
+	conf.CloseClock = time.Date(1, 1, 1, 18, 30, 0, 0, time.Local)
+	h := &Handler{Configuration: func(uint32) *Configuration { return &conf }}
+
+	body := serve(h, testSettingRequest)
+	got, err := ParseGetSettingResponse(body)
+	if err != nil {
+		t.Fatalf("ParseGetSettingResponse() error = %v", err)
+	}
+	if got.RespondingType != NewParameterValue {
+		t.Errorf("RespondingType = %v, want %v", got.RespondingType, NewParameterValue)
+	}
+	if got.Flag != 0x0200 {
+		t.Errorf("Flag = %04X, want %04X", got.Flag, 0x0200)
+	}
+	if got.Speed != High || got.UploadCycle != 10 || got.CloseHour != 18 || got.CloseMinute != 30 {
+		t.Errorf("ParseGetSettingResponse() = %v, configuration not applied", got)
+	}
+
+	// encode again
+	bin, err := got.Binary()
+	if err != nil {
+		t.Fatalf("Binary() error = %v", err)
+	}
+	if want := strings.TrimPrefix(body, "result="); fmt.Sprintf("%X", bin) != want {
+		t.Errorf("Binary() = %X, want %s", bin, want)
+	}
+}
+
+func TestParseCacheResponse(t *testing.T) {
+	h := &Handler{}
+
+	body := serve(h, testCacheRequest)
+	got, err := ParseCacheResponse(body)
+	if err != nil {
+		t.Fatalf("ParseCacheResponse() error = %v", err)
+	}
+	if got.AnswerType != OK {
+		t.Errorf("AnswerType = %v, want %v", got.AnswerType, OK)
+	}
+	if got.Flag != 0x0200 {
+		t.Errorf("Flag = %04X, want %04X", got.Flag, 0x0200)
+	}
+	if got.CloseHour != 23 || got.CloseMinute != 59 {
+		t.Errorf("ParseCacheResponse() = %v, want close clock 23:59", got)
+	}
+
+	// without prefix
+	if _, err := ParseCacheResponse(strings.TrimPrefix(body, "result=")); err != nil {
+		t.Errorf("ParseCacheResponse() error = %v", err)
+	}
+}
+
+func TestParseResponseError(t *testing.T) {
+	setting := serve(&Handler{}, testSettingRequest)
+	cache := serve(&Handler{}, testCacheRequest)
+
+	// flip last digit of crc
+	corrupt := func(body string) string {
+		last := body[len(body)-1]
+		if last == '0' {
+			return body[:len(body)-1] + "1"
+		}
+		return body[:len(body)-1] + "0"
+	}
+
+	if _, err := ParseGetSettingResponse(corrupt(setting)); !errors.Is(err, ErrInvalidCRC) {
+		t.Errorf("ParseGetSettingResponse() error = %v, want %v", err, ErrInvalidCRC)
+	}
+	if _, err := ParseCacheResponse(corrupt(cache)); !errors.Is(err, ErrInvalidCRC) {
+		t.Errorf("ParseCacheResponse() error = %v, want %v", err, ErrInvalidCRC)
+	}
+
+	tests := []string{"", "result=", "result=XYZ", cache}
+	for _, body := range tests {
+		if _, err := ParseGetSettingResponse(body); err == nil {
+			t.Errorf("ParseGetSettingResponse(%q) error = %v, want error", body, err)
+		}
+	}
+	if _, err := ParseCacheResponse(setting); err == nil {
+		t.Errorf("ParseCacheResponse() error = %v, want error", err)
+	}
+}
@@ -0,0 +1,408 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Kinds of frame, which can be described.
+const (
+	KindGetSettingRequest  = "GetSettingRequest"
+	KindGetSettingResponse = "GetSettingResponse"
+	KindCacheData          = "CacheData"
+	KindCacheResponse      = "CacheResponse"
+	KindDeviceStatus       = "DeviceStatus"
+)
+
+// FieldDescription is a field of frame.
+type FieldDescription struct {
+	Name   string
+	Offset int
+	Raw    []byte
+	Value  string // decoded value
+}
+
+// FrameDescription describe every field of frame, made by Describe.
+type FrameDescription struct {
+	Kind   string
+	Fields []FieldDescription
+	Crc    string // `ok`, `incorrect, want XXXX` or `not verified`
+}
+
+// String returns table of fields, such as:
+//
+//	GetSettingRequest, 53 byte, crc ok
+//	offset  hex       field           value
+//	0       0D3BB382  SerialNumber    0D3BB382
+//	4       03        TimeVerifyMode  Both
+//	...
+func (d *FrameDescription) String() string {
+	size := 0
+	for _, f := range d.Fields {
+		size += len(f.Raw)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %d byte, crc %s\n", d.Kind, size, d.Crc)
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "offset\thex\tfield\tvalue")
+	for _, f := range d.Fields {
+		fmt.Fprintf(w, "%d\t%X\t%s\t%s\n", f.Offset, f.Raw, f.Name, f.Value)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// Describe describe every field of frame.
+//
+// Kind of frame is guessed by its length.
+// Both of CacheData and CacheResponse are 17 byte,
+// frame treated as CacheResponse only if it starts with valid AnswerType and month,
+// use DescribeAs if you know kind of frame.
+func Describe(frame []byte) (*FrameDescription, error) {
+	switch len(frame) {
+	case GetSettingRequestSize:
+		return DescribeAs(KindGetSettingRequest, frame)
+	case GetSettingResponseSize:
+		return DescribeAs(KindGetSettingResponse, frame)
+	case DeviceStatusSize:
+		return DescribeAs(KindDeviceStatus, frame)
+	case CacheDataSize:
+		if frame[0] <= byte(OK) && 1 <= frame[5] && frame[5] <= 12 {
+			return DescribeAs(KindCacheResponse, frame)
+		}
+		return DescribeAs(KindCacheData, frame)
+	}
+	return nil, fmt.Errorf("failed to describe frame: unknown length %d byte", len(frame))
+}
+
+// DescribeAs describe every field of frame, as frame of `kind`.
+func DescribeAs(kind string, frame []byte) (*FrameDescription, error) {
+	layout, ok := frameLayouts[kind]
+	if !ok {
+		return nil, fmt.Errorf("failed to describe frame: unknown kind %s", kind)
+	}
+
+	size := 0
+	for _, f := range layout {
+		size += f.size
+	}
+	if len(frame) != size {
+		return nil, fmt.Errorf("failed to describe %s: length must be %d byte, but came %d byte", kind, size, len(frame))
+	}
+
+	d := &FrameDescription{Kind: kind}
+	offset := 0
+	for _, f := range layout {
+		raw := frame[offset : offset+f.size]
+		d.Fields = append(d.Fields, FieldDescription{
+			Name:   f.name,
+			Offset: offset,
+			Raw:    raw,
+			Value:  f.format(raw),
+		})
+		offset += f.size
+	}
+
+	switch {
+	case kind == KindDeviceStatus:
+		d.Crc = "not verified"
+	case Verify(frame):
+		d.Crc = "ok"
+	default:
+		d.Crc = fmt.Sprintf("incorrect, want %04X", Crc16(frame[:len(frame)-Crc16Size]))
+	}
+	return d, nil
+}
+
+// Dump write description of every frame in `line` to `w`.
+//
+// Line can be body of request(`cmd=...`), body of response(`result=...`), or hex of a frame.
+// Text before body is ignored, so line of log can be pasted as it is.
+func Dump(w io.Writer, line string) error {
+	line = strings.TrimSpace(line)
+
+	if i := strings.Index(line, "cmd="); i >= 0 {
+		return dumpRequest(w, line[i:])
+	}
+
+	var descriptions []*FrameDescription
+	if i := strings.Index(line, "result="); i >= 0 {
+		frame, err := decodeResult(line[i:])
+		if err != nil {
+			return fmt.Errorf("failed to decode result: %s", err.Error())
+		}
+		kind := KindCacheResponse
+		if len(frame) == GetSettingResponseSize {
+			kind = KindGetSettingResponse
+		}
+		d, err := DescribeAs(kind, frame)
+		if err != nil {
+			return err
+		}
+		descriptions = append(descriptions, d)
+	} else {
+		frame, err := hex.DecodeString(line)
+		if err != nil {
+			return fmt.Errorf("failed to decode frame: %s", err.Error())
+		}
+		d, err := Describe(frame)
+		if err != nil {
+			return err
+		}
+		descriptions = append(descriptions, d)
+	}
+	return writeDescriptions(w, descriptions)
+}
+
+// dumpRequest write description of request
+func dumpRequest(w io.Writer, body string) error {
+	schema, err := NewRequestSchema(strings.Fields(body)[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "cmd=%s flag=%04X(%02d:%02d)", schema.Cmd, schema.Flag, schema.Flag>>8, schema.Flag&0xFF)
+	if schema.Cmd == "cache" {
+		fmt.Fprintf(w, " count=%d", schema.Count)
+		if int(schema.Count) != len(schema.Data) {
+			fmt.Fprintf(w, "(but %d data)", len(schema.Data))
+		}
+	}
+	fmt.Fprint(w, "\n\n")
+
+	var descriptions []*FrameDescription
+	switch schema.Cmd {
+	case "getsetting":
+		d, err := DescribeAs(KindGetSettingRequest, schema.Data[0])
+		if err != nil {
+			return err
+		}
+		descriptions = append(descriptions, d)
+
+	case "cache":
+		status, err := hex.DecodeString(schema.Status)
+		if err != nil {
+			return fmt.Errorf("failed to decode status: %s", err.Error())
+		}
+		d, err := DescribeAs(KindDeviceStatus, status)
+		if err != nil {
+			return err
+		}
+		descriptions = append(descriptions, d)
+
+		for _, data := range schema.Data {
+			d, err := DescribeAs(KindCacheData, data)
+			if err != nil {
+				return err
+			}
+			descriptions = append(descriptions, d)
+		}
+
+	default:
+		return errors.New("failed to describe request: unknown command " + schema.Cmd)
+	}
+	return writeDescriptions(w, descriptions)
+}
+
+func writeDescriptions(w io.Writer, descriptions []*FrameDescription) error {
+	for i, d := range descriptions {
+		if i != 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, d.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldLayout is a field of frame
+type fieldLayout struct {
+	name   string
+	size   int
+	format func(raw []byte) string
+}
+
+func formatHex(raw []byte) string { return fmt.Sprintf("%X", raw) }
+
+func formatU8(raw []byte) string { return fmt.Sprintf("%d", raw[0]) }
+
+func formatYear(raw []byte) string { return fmt.Sprintf("%d", 2000+int(raw[0])) }
+
+func formatPercent(raw []byte) string { return fmt.Sprintf("%d%%", raw[0]) }
+
+func formatMinute(raw []byte) string {
+	if raw[0] == 0 {
+		return "0(real-time)"
+	}
+	return fmt.Sprintf("%d min", raw[0])
+}
+
+func formatU32LE(raw []byte) string { return fmt.Sprintf("%d", binary.LittleEndian.Uint32(raw)) }
+
+func formatMac(raw []byte) string {
+	s := make([]string, len(raw))
+	for i, b := range raw {
+		s[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(s, ":")
+}
+
+func formatVersion(raw []byte) string { return fmt.Sprintf("%d.%d", raw[0], raw[1]) }
+
+// formatEnum returns format of enum, which value start from `base`.
+// String methods of enums are not used, because they panic with unknown value.
+func formatEnum(names []string, base byte) func(raw []byte) string {
+	return func(raw []byte) string {
+		i := int(raw[0]) - int(base)
+		if i < 0 || i >= len(names) || names[i] == "" {
+			return fmt.Sprintf("unknown(%d)", raw[0])
+		}
+		return names[i]
+	}
+}
+
+var (
+	uploadClockLayout = []fieldLayout{
+		{"UploadHour1", 1, formatU8},
+		{"UploadMinute1", 1, formatU8},
+		{"UploadHour2", 1, formatU8},
+		{"UploadMinute2", 1, formatU8},
+		{"UploadHour3", 1, formatU8},
+		{"UploadMinute3", 1, formatU8},
+		{"UploadHour4", 1, formatU8},
+		{"UploadMinute4", 1, formatU8},
+	}
+
+	dateTimeLayout = []fieldLayout{
+		{"Year", 1, formatYear},
+		{"Month", 1, formatU8},
+		{"Day", 1, formatU8},
+		{"Hour", 1, formatU8},
+		{"Minute", 1, formatU8},
+		{"Second", 1, formatU8},
+	}
+
+	businessHoursLayout = []fieldLayout{
+		{"OpenHour", 1, formatU8},
+		{"OpenMinute", 1, formatU8},
+		{"CloseHour", 1, formatU8},
+		{"CloseMinute", 1, formatU8},
+	}
+
+	crcLayout = []fieldLayout{
+		{"Crc16", 2, formatHex},
+	}
+)
+
+// layout join fields
+func layout(fields ...[]fieldLayout) []fieldLayout {
+	var joined []fieldLayout
+	for _, f := range fields {
+		joined = append(joined, f...)
+	}
+	return joined
+}
+
+var frameLayouts = map[string][]fieldLayout{
+	KindGetSettingRequest: layout(
+		[]fieldLayout{
+			{"SerialNumber", 4, formatHex},
+			{"TimeVerifyMode", 1, formatEnum(timeVerifyModeString, 0)},
+			{"Speed", 1, formatEnum(speedString, 0)},
+			{"RecordingCycle", 1, formatMinute},
+			{"UploadCycle", 1, formatMinute},
+			{"FixedTimeUpload", 1, formatU8},
+		},
+		uploadClockLayout,
+		[]fieldLayout{
+			{"NetworkType", 1, formatEnum(networkTypeString, 0)},
+			{"DisplayType", 1, formatEnum(displayTypeString, 0)},
+			{"MacAddress1", 7, formatMac},
+			{"MacAddress2", 7, formatMac},
+			{"MacAddress3", 7, formatMac},
+		},
+		dateTimeLayout,
+		[]fieldLayout{
+			{"Week", 1, formatU8},
+		},
+		businessHoursLayout,
+		crcLayout,
+	),
+	KindGetSettingResponse: layout(
+		[]fieldLayout{
+			{"RespondingType", 1, formatEnum(respondingTypeString, byte(NewParameterValue))},
+			{"Flag", 2, formatHex},
+			{"SerialNumber", 4, formatHex},
+			{"TimeVerifyMode", 1, formatEnum(timeVerifyModeString, 0)},
+			{"Speed", 1, formatEnum(speedString, 0)},
+			{"RecordingCycle", 1, formatMinute},
+			{"UploadCycle", 1, formatMinute},
+			{"FixedTimeUpload", 1, formatU8},
+		},
+		uploadClockLayout,
+		[]fieldLayout{
+			{"NetworkType", 1, formatEnum(networkTypeString, 0)},
+			{"DisplayType", 1, formatEnum(displayTypeString, 0)},
+			{"MacAddress1", 7, formatMac},
+			{"MacAddress2", 7, formatMac},
+			{"MacAddress3", 7, formatMac},
+		},
+		dateTimeLayout,
+		[]fieldLayout{
+			{"Week", 1, formatU8},
+		},
+		businessHoursLayout,
+		[]fieldLayout{
+			{"Reserved1", 1, formatHex},
+			{"Reserved2", 1, formatHex},
+		},
+		crcLayout,
+	),
+	KindCacheData: layout(
+		dateTimeLayout,
+		[]fieldLayout{
+			{"Focus", 1, formatEnum(focusString, 0)},
+			{"DxIn", 4, formatU32LE},
+			{"DxOut", 4, formatU32LE},
+		},
+		crcLayout,
+	),
+	KindCacheResponse: layout(
+		[]fieldLayout{
+			{"AnswerType", 1, formatEnum(answerType, 0)},
+			{"Flag", 2, formatHex},
+			{"TimeVerifyMode", 1, formatEnum(timeVerifyModeString, 0)},
+		},
+		dateTimeLayout,
+		[]fieldLayout{
+			{"Week", 1, formatU8},
+		},
+		businessHoursLayout,
+		crcLayout,
+	),
+	KindDeviceStatus: layout(
+		[]fieldLayout{
+			{"Version", 2, formatVersion},
+			{"SerialNumber", 4, formatHex},
+			{"Focus", 1, formatEnum(focusString, 0)},
+			{"TransmitterBAT", 1, formatPercent},
+			{"Reserved1", 1, formatHex},
+			{"CounterBAT", 1, formatPercent},
+			{"Charge", 1, formatEnum(cargeString, 0)},
+			{"Reserved2", 1, formatHex},
+		},
+		crcLayout,
+	),
+}
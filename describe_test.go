@@ -0,0 +1,175 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestFrameLayouts(t *testing.T) {
+	sizes := map[string]int{
+		KindGetSettingRequest:  GetSettingRequestSize,
+		KindGetSettingResponse: GetSettingResponseSize,
+		KindCacheData:          CacheDataSize,
+		KindCacheResponse:      CacheResponseSize,
+		KindDeviceStatus:       DeviceStatusSize,
+	}
+	for kind, want := range sizes {
+		got := 0
+		for _, f := range frameLayouts[kind] {
+			got += f.size
+		}
+		if got != want {
+			t.Errorf("size of %s = %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	setResp, cacheResp := testResponses(t)
+	setBin, _ := setResp.Binary()
+	cacheBin, _ := cacheResp.Binary()
+
+	tests := []struct {
+		name     string
+		frame    string
+		wantKind string
+		wantCrc  string
+		want     map[string]string // field to value
+	}{
+		{
+			name:     "GetSettingRequest",
+			frame:    "0D3BB382030000000000000000000000000002085DDD5A75CBDC0A5DDD5A75CBDC909F33173CE4DA0F0101000002010000173BECE4",
+			wantKind: KindGetSettingRequest,
+			wantCrc:  "ok",
+			want: map[string]string{
+				"SerialNumber":   "0D3BB382",
+				"TimeVerifyMode": "Both",
+				"UploadCycle":    "0(real-time)",
+				"MacAddress1":    "08:5D:DD:5A:75:CB:DC",
+				"Year":           "2015",
+				"CloseHour":      "23",
+				"Crc16":          "ECE4",
+			},
+		},
+		{
+			name:     "GetSettingResponse",
+			frame:    hex.EncodeToString(setBin),
+			wantKind: KindGetSettingResponse,
+			wantCrc:  "ok",
+			want:     map[string]string{"RespondingType": "Confirmation", "Flag": "0200"},
+		},
+		{
+			name:     "CacheData",
+			frame:    "15050D0D332A000100000000000000E97E",
+			wantKind: KindCacheData,
+			wantCrc:  "ok",
+			want:     map[string]string{"Year": "2021", "Focus": "Focused", "DxIn": "1", "DxOut": "0"},
+		},
+		{
+			name:     "CacheData with incorrect crc",
+			frame:    "15050D0D332A000200000000000000E97E",
+			wantKind: KindCacheData,
+			wantCrc:  "incorrect, want",
+			want:     map[string]string{"DxIn": "2"},
+		},
+		{
+			name:     "CacheResponse",
+			frame:    hex.EncodeToString(cacheBin),
+			wantKind: KindCacheResponse,
+			wantCrc:  "ok",
+			want:     map[string]string{"AnswerType": "OK", "CloseMinute": "59"},
+		},
+		{
+			name:     "DeviceStatus",
+			frame:    "010142AE51520156000D0001E6A7",
+			wantKind: KindDeviceStatus,
+			wantCrc:  "not verified",
+			want:     map[string]string{"Version": "1.1", "SerialNumber": "42AE5152", "TransmitterBAT": "86%", "Charge": "NotCharged"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, _ := hex.DecodeString(tt.frame)
+			got, err := Describe(frame)
+			if err != nil {
+				t.Fatalf("Describe() error = %v", err)
+			}
+			if got.Kind != tt.wantKind || !strings.HasPrefix(got.Crc, tt.wantCrc) {
+				t.Errorf("Describe() = %v, %v, want %v, %v", got.Kind, got.Crc, tt.wantKind, tt.wantCrc)
+			}
+			for _, f := range got.Fields {
+				if want, ok := tt.want[f.Name]; ok && f.Value != want {
+					t.Errorf("%s = %v, want %v", f.Name, f.Value, want)
+				}
+			}
+		})
+	}
+
+	if _, err := Describe(make([]byte, 3)); err == nil {
+		t.Errorf("Describe() error = %v, want error", err)
+	}
+	// unknown value of enum
+	d, err := DescribeAs(KindDeviceStatus, []byte{1, 1, 0, 0, 0, 0, 9, 0, 0, 0, 9, 0, 0, 0})
+	if err != nil {
+		t.Fatalf("DescribeAs() error = %v", err)
+	}
+	if got := d.Fields[2].Value; got != "unknown(9)" {
+		t.Errorf("Focus = %v, want %v", got, "unknown(9)")
+	}
+}
+
+func TestDump(t *testing.T) {
+	setting := serve(&Handler{}, testSettingRequest)
+
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{
+			name: "getsetting",
+			line: "> request from: 127.0.0.1:50000 " + testSettingRequest,
+			want: []string{"cmd=getsetting flag=0002(00:02)", "GetSettingRequest, 53 byte, crc ok", "SerialNumber"},
+		},
+		{
+			name: "cache",
+			line: testCacheRequest,
+			want: []string{"count=2", "DeviceStatus, 14 byte, crc not verified", "CacheData, 17 byte, crc ok", "DxOut"},
+		},
+		{
+			name: "result",
+			line: "< response with: " + setting,
+			want: []string{"GetSettingResponse, 58 byte, crc ok", "RespondingType"},
+		},
+		{
+			name: "hex",
+			line: "15050D0D332A000100000000000000E97E\n",
+			want: []string{"CacheData, 17 byte, crc ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := Dump(&b, tt.line); err != nil {
+				t.Fatalf("Dump() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("Dump() = %v, want contains %v", b.String(), want)
+				}
+			}
+		})
+	}
+
+	for _, line := range []string{"nothing", "result=0102", "cmd=unknown&flag=0002&data=00000000000000000000"} {
+		if err := Dump(&strings.Builder{}, line); err == nil {
+			t.Errorf("Dump(%q) error = %v, want error", line, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"fmt"
+	"time"
+)
+
+// DriftPolicy decide how counter treat occupants out of range,
+// which means negative, or over Capacity.Full given to SetCapacity.
+//
+// Occupants drift when sensor miss someone or count someone twice,
+// or people pass unmonitored exit.
+type DriftPolicy struct {
+	Clamp       bool // GetOccupants returns value within range, but in/out kept as is
+	AutoCorrect bool // when occupants out of range, correct it to nearest bound, recorded as Correction by "auto"
+}
+
+// Drift is statistics of occupants went out of range.
+type Drift struct {
+	Negative     int       `json:"negative"`      // number of times occupants went negative
+	MaxNegative  int       `json:"max_negative"`  // farthest below zero
+	OverCapacity int       `json:"over_capacity"` // number of times occupants exceeded capacity
+	MaxOver      int       `json:"max_over"`      // farthest above capacity
+	Last         time.Time `json:"last"`          // event time of last drift
+}
+
+// SetDriftPolicy apply policy to counter
+func (c *counter) SetDriftPolicy(policy DriftPolicy) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.driftPolicy = policy
+}
+
+// Drift returns statistics of drift, since counter created.
+//
+// Frequent drift means sensor badly aligned.
+func (c *counter) Drift() Drift {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.drift
+}
+
+// clamp bound occupants within range, if policy requires
+func (c *counter) clamp(occupants int) int {
+	if !c.driftPolicy.Clamp {
+		return occupants
+	}
+	if occupants < 0 {
+		return 0
+	}
+	if c.capacity.Full > 0 && occupants > c.capacity.Full {
+		return c.capacity.Full
+	}
+	return occupants
+}
+
+// checkDrift record drift after counted, and correct it if policy requires.
+// Caller must hold lock.
+func (c *counter) checkDrift(eventTime time.Time) {
+	occupants := c.occupants()
+	capacity := c.capacity.Full
+
+	var bound int
+	switch {
+	case occupants < 0:
+		bound = 0
+		if c.drifting >= 0 {
+			c.drift.Negative++
+		}
+		c.drifting = -1
+		if -occupants > c.drift.MaxNegative {
+			c.drift.MaxNegative = -occupants
+		}
+	case capacity > 0 && occupants > capacity:
+		bound = capacity
+		if c.drifting <= 0 {
+			c.drift.OverCapacity++
+		}
+		c.drifting = 1
+		if occupants-capacity > c.drift.MaxOver {
+			c.drift.MaxOver = occupants - capacity
+		}
+	default:
+		c.drifting = 0
+		return
+	}
+
+	c.drift.Last = eventTime
+
+	if c.driftPolicy.AutoCorrect {
+		if _, err := c.correct(bound, "auto", fmt.Sprintf("occupants out of range: %d", occupants)); err != nil {
+			debugf("! failed to correct drift: %s\n", err.Error())
+			return
+		}
+		c.drifting = 0
+	}
+}
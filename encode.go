@@ -0,0 +1,79 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Encoders of requests, which sent by device.
+// They are useful for tests, simulators and proxies.
+
+// NewFlag returns flag of request sent at `t`.
+// Device send minute and second of its system time as flag.
+func NewFlag(t time.Time) uint16 {
+	return uint16(t.Minute())<<8 | uint16(t.Second())
+}
+
+// Binary returns data of getsetting request, with crc.
+//   - SerialNumber must be 4 byte, MacAddress 7 byte
+//   - Crc16 field is ignored, crc calculated again
+func (request GetSettingRequest) Binary() ([]byte, error) {
+	return request.AppendBinary(nil)
+}
+
+// Body returns body of getsetting request, such as:
+//
+//	cmd=getsetting&flag=0002&data=0D3BB382...
+func (request GetSettingRequest) Body(flag uint16) (string, error) {
+	bin, err := request.Binary()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode GetSettingRequest: %s", err.Error())
+	}
+	return fmt.Sprintf("cmd=getsetting&flag=%04X&data=%X", flag, bin), nil
+}
+
+// Binary returns status of cache request.
+//
+// Algorithm of crc for status is unknown(it is not verified by NewDeviceStatus),
+// so Crc16 field written as it is.
+func (status DeviceStatus) Binary() ([]byte, error) {
+	return status.AppendBinary(nil)
+}
+
+// Binary returns a data of cache request, with crc.
+//   - Crc16 field is ignored, crc calculated again
+func (data CacheData) Binary() ([]byte, error) {
+	return data.AppendBinary(nil)
+}
+
+// Body returns body of cache request, such as:
+//
+//	cmd=cache&flag=0002&status=010142AE...&count=2&data=15050D0D...&data=15050D0D...
+//
+// Status can not be nil.
+func (request CacheRequest) Body(flag uint16) (string, error) {
+	if request.Status == nil {
+		return "", errors.New("failed to encode CacheRequest: status can not be nil")
+	}
+	status, err := request.Status.Binary()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode CacheRequest: %s", err.Error())
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "cmd=cache&flag=%04X&status=%X&count=%X", flag, status, len(request.Data))
+	var scratch [CacheDataSize]byte
+	for _, data := range request.Data {
+		bin, err := data.AppendBinary(scratch[:0])
+		if err != nil {
+			return "", fmt.Errorf("failed to encode CacheRequest: %s", err.Error())
+		}
+		fmt.Fprintf(&body, "&data=%X", bin)
+	}
+	return body.String(), nil
+}
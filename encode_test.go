@@ -0,0 +1,91 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetSettingRequestBody(t *testing.T) {
+	tests := []string{
+		testSettingRequest,
+		"cmd=getsetting&flag=1E28&data=0D3BB382030000000000000000000000000002085DDD5A75CBDC0A5DDD5A75CBDC909F33173CE4DA0F0101001E28000000173BE720",
+		"cmd=getsetting&flag=012B&data=0D3BB382030000000000000000000000000000085DDD5A75CBDC0A5DDD5A75CBDC909F33173CE4DA1506020E012B000000173B6B46",
+	}
+
+	for _, want := range tests {
+		t.Run("", func(t *testing.T) {
+			schema, err := NewRequestSchema(want)
+			if err != nil {
+				t.Fatalf("NewRequestSchema() error = %v", err)
+			}
+			setReq, err := NewSettingRequest(schema.Data[0])
+			if err != nil {
+				t.Fatalf("NewSettingRequest() error = %v", err)
+			}
+
+			got, err := setReq.Body(schema.Flag)
+			if err != nil {
+				t.Fatalf("Body() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("Body() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := (GetSettingRequest{}).Body(0); err == nil {
+		t.Errorf("Body() error = %v, want error for empty serial number", err)
+	}
+}
+
+func TestCacheRequestBody(t *testing.T) {
+	schema, err := NewRequestSchema(testCacheRequest)
+	if err != nil {
+		t.Fatalf("NewRequestSchema() error = %v", err)
+	}
+	cacheReq, err := NewCacheRequest(schema)
+	if err != nil {
+		t.Fatalf("NewCacheRequest() error = %v", err)
+	}
+
+	got, err := cacheReq.Body(schema.Flag)
+	if err != nil {
+		t.Fatalf("Body() error = %v", err)
+	}
+	if got != testCacheRequest {
+		t.Errorf("Body() = %v, want %v", got, testCacheRequest)
+	}
+
+	// crc of data calculated again
+	cacheReq.Data[0].DxIn = 3
+	cacheReq.Data[0].Crc16 = 0
+	body, err := cacheReq.Body(schema.Flag)
+	if err != nil {
+		t.Fatalf("Body() error = %v", err)
+	}
+	schema, err = NewRequestSchema(body)
+	if err != nil {
+		t.Fatalf("NewRequestSchema() error = %v", err)
+	}
+	parsed, err := NewCacheRequest(schema)
+	if err != nil {
+		t.Fatalf("NewCacheRequest() error = %v", err)
+	}
+	if parsed.Data[0].DxIn != 3 {
+		t.Errorf("DxIn = %v, want %v", parsed.Data[0].DxIn, 3)
+	}
+
+	if _, err := (CacheRequest{}).Body(0); err == nil {
+		t.Errorf("Body() error = %v, want error for nil status", err)
+	}
+}
+
+func TestNewFlag(t *testing.T) {
+	got := NewFlag(time.Date(2021, 5, 13, 13, 30, 40, 0, time.Local))
+	if got != 0x1E28 {
+		t.Errorf("NewFlag() = %04X, want %04X", got, 0x1E28)
+	}
+}
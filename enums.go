@@ -157,3 +157,60 @@ var cargeString = []string{
 func (m Charge) String() string {
 	return cargeString[m]
 }
+
+// ResetMode represent when counter reset its occupancy.
+type ResetMode byte
+
+const (
+	NoReset ResetMode = iota
+	ResetAtOpen
+	ResetAtClose
+)
+
+var resetModeString = []string{
+	"NoReset",
+	"ResetAtOpen",
+	"ResetAtClose",
+}
+
+func (m ResetMode) String() string {
+	return resetModeString[m]
+}
+
+// CapacityLevel represent how crowded, compared to Capacity.
+type CapacityLevel byte
+
+const (
+	Available CapacityLevel = iota
+	Crowded
+	Full
+)
+
+var capacityLevelString = []string{
+	"Available",
+	"Crowded",
+	"Full",
+}
+
+func (m CapacityLevel) String() string {
+	return capacityLevelString[m]
+}
+
+// DeviceState represent whether device upload as scheduled.
+type DeviceState byte
+
+const (
+	Alive DeviceState = iota
+	Late
+	Offline
+)
+
+var deviceStateString = []string{
+	"Alive",
+	"Late",
+	"Offline",
+}
+
+func (m DeviceState) String() string {
+	return deviceStateString[m]
+}
@@ -0,0 +1,337 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event represent a CacheData, with device and time it received.
+type Event struct {
+	SerialNumber uint32    `json:"serial"`
+	EventTime    time.Time `json:"event_time"`
+	DxIn         uint32    `json:"in"`
+	DxOut        uint32    `json:"out"`
+	Focus        Focus     `json:"focus"`
+	Received     time.Time `json:"received"`
+}
+
+// NewEvent makes Event from CacheData, which sent by device of `serialNumber`.
+func NewEvent(serialNumber uint32, data *CacheData, received time.Time) Event {
+	return Event{
+		SerialNumber: serialNumber,
+		EventTime:    data.Time(),
+		DxIn:         data.DxIn,
+		DxOut:        data.Dxout,
+		Focus:        data.Focus,
+		Received:     received,
+	}
+}
+
+// data makes CacheData of event, reverse of NewEvent
+func (e Event) data() *CacheData {
+	t := e.EventTime.In(time.Local)
+	return &CacheData{
+		Year:    byte(t.Year() - 2000),
+		Month:   byte(t.Month()),
+		Day:     byte(t.Day()),
+		Hour:    byte(t.Hour()),
+		Minute:  byte(t.Minute()),
+		Secound: byte(t.Second()),
+		DxIn:    e.DxIn,
+		Dxout:   e.DxOut,
+		Focus:   e.Focus,
+	}
+}
+
+// EventLog is append-only log of events, written as JSON lines.
+//
+// When size of file exceed limit, file renamed with suffix of rotated time,
+// and new file created at same path.
+//
+// Line is not complete until its newline written. If process crashed while appending,
+// incomplete last line is truncated when log opened again.
+type EventLog struct {
+	path    string
+	maxSize int64 // 0 means no rotation
+	file    *os.File
+	size    int64
+	mux     *sync.Mutex
+}
+
+// OpenEventLog open or create event log at `path`.
+//
+// Log rotated when it become larger than `maxSize` byte, 0 means never rotate.
+func OpenEventLog(path string, maxSize int64) (*EventLog, error) {
+	l := &EventLog{
+		path:    path,
+		maxSize: maxSize,
+		mux:     &sync.Mutex{},
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *EventLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %s", err.Error())
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open event log: %s", err.Error())
+	}
+
+	// drop incomplete line, written by crashed process
+	size, err := completeSize(file, info.Size())
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open event log: %s", err.Error())
+	}
+	if size != info.Size() {
+		if err := file.Truncate(size); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to open event log: %s", err.Error())
+		}
+		if EnableDebugMessage {
+			fmt.Fprintf(DebugOutput, "- event log truncated: %d byte of incomplete line dropped\n", info.Size()-size)
+		}
+	}
+
+	l.file = file
+	l.size = size
+	return nil
+}
+
+// completeSize returns size of file, up to last newline
+func completeSize(file *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		begin := end - int64(len(buf))
+		if begin < 0 {
+			begin = 0
+		}
+		chunk := buf[:end-begin]
+		if _, err := file.ReadAt(chunk, begin); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return begin + int64(i) + 1, nil
+		}
+		end = begin
+	}
+	return 0, nil
+}
+
+// Append write events to log, and sync to disk before return.
+//
+// All events written in one write, so events of one request are not splitted into rotated files.
+func (l *EventLog) Append(events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to append event: %s", err.Error())
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("failed to append event: log closed")
+	}
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(buf)) > l.maxSize {
+		// events are persisted anyway, rotation tried again on next append
+		if err := l.rotate(); err != nil && EnableDebugMessage {
+			fmt.Fprintf(DebugOutput, "! %s\n", err.Error())
+		}
+	}
+
+	if _, err := l.file.Write(buf); err != nil {
+		// do not leave partial line, next append would follow it
+		l.file.Truncate(l.size)
+		return fmt.Errorf("failed to append event: %s", err.Error())
+	}
+	l.size += int64(len(buf))
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to append event: %s", err.Error())
+	}
+	return nil
+}
+
+// rename is os.Rename, replaced by test
+var rename = os.Rename
+
+// rotate rename current file and open new one.
+//
+// If it failed, current file is kept open, so events still appended to it.
+func (l *EventLog) rotate() error {
+	rotated := l.path + "." + time.Now().Format("20060102T150405.000000000")
+	if err := rename(l.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate event log: %s", err.Error())
+	}
+
+	file, size := l.file, l.size
+	if err := l.open(); err != nil {
+		// put it back, and keep appending to it
+		l.file, l.size = file, size
+		if err := rename(rotated, l.path); err != nil {
+			return fmt.Errorf("failed to rotate event log: %s", err.Error())
+		}
+		return err
+	}
+	file.Close()
+
+	if EnableDebugMessage {
+		fmt.Fprintf(DebugOutput, "- event log rotated: %s\n", rotated)
+	}
+	return nil
+}
+
+// Close close file of log
+func (l *EventLog) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// scan call `fn` with every event in log, in order of written.
+//
+// Appending is blocked only while files listed, not while reading.
+// Rotated files are never written again, and current file is read
+// up to its size when listed, through handle opened before it can be rotated.
+func (l *EventLog) scan(fn func(Event) error) error {
+	l.mux.Lock()
+	rotated, err := rotatedFiles(l.path)
+	if err != nil {
+		l.mux.Unlock()
+		return err
+	}
+	current, err := os.Open(l.path)
+	size := l.size
+	l.mux.Unlock()
+
+	if os.IsNotExist(err) {
+		current, size = nil, 0
+	} else if err != nil {
+		return fmt.Errorf("failed to read event log: %s", err.Error())
+	} else {
+		defer current.Close()
+	}
+
+	for _, p := range rotated {
+		if err := scanEventPath(p, fn); err != nil {
+			return err
+		}
+	}
+	if current == nil {
+		return nil
+	}
+	return scanEventFile(l.path, io.LimitReader(current, size), fn)
+}
+
+// rotatedFiles returns rotated files of log at `path`, oldest first
+func rotatedFiles(path string) ([]string, error) {
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// ReadEventLog read all events from log at `path`, including rotated files,
+// in order of written.
+//
+// Incomplete last line of file, left by crash while appending, is ignored.
+// Broken line in the middle of file is error.
+func ReadEventLog(path string) ([]Event, error) {
+	var events []Event
+	err := scanEventLog(path, func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// scanEventLog call `fn` with every event in log at `path`, including rotated files,
+// in order of written. Events are not loaded in memory all at once.
+func scanEventLog(path string, fn func(Event) error) error {
+	rotated, err := rotatedFiles(path)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range append(rotated, path) {
+		if err := scanEventPath(p, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanEventPath call `fn` with every event in file at `p`, missing file is ignored
+func scanEventPath(p string, fn func(Event) error) error {
+	file, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read event log: %s", err.Error())
+	}
+	defer file.Close()
+
+	return scanEventFile(p, file, fn)
+}
+
+func scanEventFile(p string, file io.Reader, fn func(Event) error) error {
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		bin, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bin) != 0 && EnableDebugMessage {
+				fmt.Fprintf(DebugOutput, "- incomplete line ignored: %s:%d\n", p, line)
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read event log: %s", err.Error())
+		}
+
+		var e Event
+		if err := json.Unmarshal(bin, &e); err != nil {
+			return fmt.Errorf("failed to read event log: %s:%d: %s", p, line, err.Error())
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	// small enough to rotate every append
+	l, err := OpenEventLog(path, 100)
+	if err != nil {
+		t.Fatalf("OpenEventLog() error = %v", err)
+	}
+
+	received := time.Date(2021, 5, 13, 13, 52, 0, 0, time.UTC)
+	want := []Event{
+		NewEvent(0x42AE5152, &CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 1}, received),
+		NewEvent(0x42AE5152, &CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 44, Dxout: 1}, received),
+		NewEvent(0x42AE5152, &CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 45, Focus: FocusOut}, received),
+	}
+	for _, e := range want {
+		if err := l.Append(e); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Errorf("rotated files = %d, want %d", len(rotated), 2)
+	}
+
+	got, err := ReadEventLog(path)
+	if err != nil {
+		t.Fatalf("ReadEventLog() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadEventLog() = %d events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].EventTime.Equal(want[i].EventTime) || !got[i].Received.Equal(want[i].Received) {
+			t.Errorf("ReadEventLog()[%d] = %v, want %v", i, got[i], want[i])
+		}
+		got[i].EventTime, got[i].Received = want[i].EventTime, want[i].Received
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("ReadEventLog()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEventLogIncompleteLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	l, err := OpenEventLog(path, 0)
+	if err != nil {
+		t.Fatalf("OpenEventLog() error = %v", err)
+	}
+	if err := l.Append(testEvent(1, 42, 1, 0), testEvent(1, 43, 0, 1)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	l.Close()
+
+	// crashed while appending
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"serial":1,"event_ti`)
+	f.Close()
+
+	got, err := ReadEventLog(path)
+	if err != nil || len(got) != 2 {
+		t.Errorf("ReadEventLog() = %d events, %v, want %d events", len(got), err, 2)
+	}
+
+	// incomplete line truncated, and next append not broken by it
+	l, err = OpenEventLog(path, 0)
+	if err != nil {
+		t.Fatalf("OpenEventLog() error = %v", err)
+	}
+	if err := l.Append(testEvent(1, 44, 1, 0)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	l.Close()
+
+	got, err = ReadEventLog(path)
+	if err != nil || len(got) != 3 {
+		t.Errorf("ReadEventLog() = %d events, %v, want %d events", len(got), err, 3)
+	}
+
+	// broken in the middle
+	bin, _ := ioutil.ReadFile(path)
+	bin = append([]byte("{broken\n"), bin...)
+	if err := ioutil.WriteFile(path, bin, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadEventLog(path); err == nil {
+		t.Errorf("ReadEventLog() error = %v, want error", err)
+	}
+}
+
+func TestEventLogRotateFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	l, err := OpenEventLog(path, 100)
+	if err != nil {
+		t.Fatalf("OpenEventLog() error = %v", err)
+	}
+	defer l.Close()
+
+	defer func() { rename = os.Rename }()
+	rename = func(from, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: os.ErrPermission}
+	}
+
+	// rotation failed, but events still persisted
+	for second := byte(0); second < 3; second++ {
+		if err := l.Append(testEvent(1, second, 1, 0)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if rotated, _ := filepath.Glob(path + ".*"); len(rotated) != 0 {
+		t.Errorf("rotated files = %d, want %d", len(rotated), 0)
+	}
+
+	// recovered
+	rename = os.Rename
+	if err := l.Append(testEvent(1, 3, 1, 0)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if rotated, _ := filepath.Glob(path + ".*"); len(rotated) != 1 {
+		t.Errorf("rotated files = %d, want %d", len(rotated), 1)
+	}
+
+	got, err := ReadEventLog(path)
+	if err != nil || len(got) != 4 {
+		t.Errorf("ReadEventLog() = %d events, %v, want %d events", len(got), err, 4)
+	}
+}
+
+func TestEventLogScanNotBlockAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	l, err := OpenEventLog(path, 100)
+	if err != nil {
+		t.Fatalf("OpenEventLog() error = %v", err)
+	}
+	defer l.Close()
+	for second := byte(0); second < 3; second++ {
+		if err := l.Append(testEvent(1, second, 1, 0)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	// append, and rotate, while scanning
+	appended := make(chan error, 1)
+	scanned := 0
+	err = l.scan(func(e Event) error {
+		if scanned == 0 {
+			go func() { appended <- l.Append(testEvent(1, 10, 1, 0)) }()
+			select {
+			case err := <-appended:
+				if err != nil {
+					t.Errorf("Append() error = %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Append() blocked by scan")
+			}
+		}
+		scanned++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	// events when scan started
+	if scanned != 3 {
+		t.Errorf("scanned = %d, want %d", scanned, 3)
+	}
+}
@@ -4,12 +4,13 @@
 package main
 
 import (
-	"fmt"
 	"io/ioutil"
 	"log"
-	"math"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/cmsong-shina/hpc015"
@@ -21,139 +22,84 @@ const (
 	server_host  = ":8888"
 	handler_path = "/cs"
 	count_path   = handler_path + "/count"
+	stream_path  = handler_path + "/stream"
+	metrics_path = "/metrics"
+	devices_path = handler_path + "/devices"
+	counter_path = "counter.json"
+	events_path  = "events.jsonl"
+	events_size  = 64 << 20 // rotate event log every 64MB
+	audit_path   = "corrections.jsonl"
 )
 
-// variable for count
+// variable for count, restored from counter_path and flushed every minute
 var (
-	counter = hpc015.Counter()
+	counter, counterErr = hpc015.PersistentCounter(counter_path, time.Minute)
+)
+
+// every accepted data written to event log, before response
+var (
+	store, storeErr = hpc015.OpenFileStore(events_path, events_size)
 )
 
 // run http server
 func main() {
-	log.Println("- server is running on:", server_host+handler_path)
-
-	http.HandleFunc(handler_path, hpc015Handler) // handle hpc015
-	http.HandleFunc(count_path, count_handler)   // handle set/get count
-
-	log.Fatal(http.ListenAndServe(server_host, nil))
-}
+	if counterErr != nil {
+		log.Fatal("! failed to restore counter:", counterErr.Error())
+	}
+	if storeErr != nil {
+		log.Fatal("! failed to open event store:", storeErr.Error())
+	}
 
-// handler
-func hpc015Handler(w http.ResponseWriter, req *http.Request) {
-	bin, _ := ioutil.ReadAll(req.Body)
+	// start every day from zero, at open time
+	counter.SetReset(hpc015.ResetAtOpen, *obtainConf(0))
 
-	fmt.Println()
-	log.Println("> request from:", req.RemoteAddr, string(bin))
-	requestSchema, err := hpc015.NewRequestSchema(string(bin))
+	// record every correction of occupants
+	audit, err := os.OpenFile(audit_path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		log.Println("! failed to parse RequestSchema:", err.Error())
-		return
+		log.Fatal("! failed to open audit log:", err.Error())
 	}
-
-	switch requestSchema.Cmd {
-	case "getsetting":
-		// getsetting has one data field
-		setReq, err := hpc015.NewSettingRequest(requestSchema.Data[0])
-		if err != nil {
-			log.Println("! failed to parse SettingRequest:", err.Error())
-			return
+	counter.SetAuditLog(audit)
+
+	// flush counter on shutdown
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		if err := counter.Close(); err != nil {
+			log.Println("! failed to flush counter:", err.Error())
 		}
-
-		// new response based on request
-		setResp := setReq.Response(requestSchema.Flag)
-
-		// (optional) when you want to manage configuration
-		{
-			// (optional) get current configuration
-			oldConf := setResp.GetConfiguration()
-			fmt.Printf("- old TimeVerifyMode: %v\n", oldConf.TimeVerifyMode)
-			fmt.Printf("- old Speed: %v\n", oldConf.Speed)
-			fmt.Printf("- old RecordingCycle: %v\n", oldConf.RecordingCycle)
-			fmt.Printf("- old UploadCycle: %v\n", oldConf.UploadCycle)
-			fmt.Printf("- old EnableFixedTimeUpload: %v\n", oldConf.EnableFixedTimeUpload)
-			fmt.Printf("- old UploadClock: %v\n", oldConf.UploadClock)
-			fmt.Printf("- old NetworkType: %v\n", oldConf.NetworkType)
-			fmt.Printf("- old DisplayType: %v\n", oldConf.DisplayType)
-			fmt.Printf("- old SystemTime: %v\n", oldConf.SystemTime)
-			fmt.Printf("- old OpenClock: %v\n", oldConf.OpenClock)
-			fmt.Printf("- old CloseClock: %v\n", oldConf.CloseClock)
-
-			// (optional) apply new configuration
-			//
-			// DO NOT change configuration every time.
-			// When you modify configuration, device send request to confirmation,
-			// and if you change system time(for example) again, device send confirmation again. It is loop.
-			//
-			// in this case, we apply SystemTime when time difference more than 5 minutes.
-
-			baseConf := obtainConf()
-
-			timeDiff := oldConf.SystemTime.Sub(baseConf.SystemTime)
-			if math.Abs(timeDiff.Minutes()) > 5 {
-				oldConf.SystemTime = baseConf.SystemTime
-			}
-			oldConf.TimeVerifyMode = baseConf.TimeVerifyMode
-			oldConf.Speed = baseConf.Speed
-			oldConf.RecordingCycle = baseConf.RecordingCycle
-			oldConf.UploadCycle = baseConf.UploadCycle
-			oldConf.EnableFixedTimeUpload = baseConf.EnableFixedTimeUpload
-			oldConf.UploadClock = baseConf.UploadClock
-			oldConf.NetworkType = baseConf.NetworkType
-			oldConf.DisplayType = baseConf.DisplayType
-			oldConf.OpenClock = baseConf.OpenClock
-			oldConf.CloseClock = baseConf.CloseClock
-
-			_, err := setResp.SetConfiguration(*oldConf)
-			if err != nil {
-				log.Println("! failed to set conf:", err.Error())
-				return
-			}
+		if err := store.Close(); err != nil {
+			log.Println("! failed to close event store:", err.Error())
 		}
+		os.Exit(0)
+	}()
+
+	// handle hpc015
+	//
+	// Cache data written to event log and counted before response,
+	// if it failed, device will keep its cache and retry.
+	metrics := hpc015.NewMetrics()
+	registry := hpc015.NewRegistry()
+	handler := &hpc015.Handler{
+		Configuration: obtainConf,
+		Store:         store,
+		Counter:       counter,
+		Metrics:       metrics,
+		Registry:      registry,
+	}
 
-		// response
-		bin, err := setResp.Binary()
-		if err != nil {
-			log.Println("! failed to convert binary:", err.Error())
-			return
-		}
-		resp := fmt.Sprintf("result=%X", bin)
-		log.Println("< response with:", resp)
-		w.Write([]byte(resp))
-		return
-
-	case "cache":
-		// device will send cache request after they got response about getsetting correctly
-
-		// create cache request
-		cacheReq, err := hpc015.NewCacheRequest(requestSchema)
-		if err != nil {
-			log.Println("! failed to parse CacheRequest:", err.Error())
-			return
-		}
+	log.Println("- server is running on:", server_host+handler_path)
 
-		// create cache response
-		cacheResp := cacheReq.Response(hpc015.OK, requestSchema.Flag, obtainConf())
+	// push updates of counter, as Server-Sent Events
+	stream := hpc015.NewEventStream(hpc015.Counters{"all": counter})
 
-		// send cache response
-		bin, err := cacheResp.Binary()
-		if err != nil {
-			log.Println("! failed to convert binary:", err.Error())
-			return
-		}
-		resp := fmt.Sprintf("result=%X", bin)
-		_, err = w.Write([]byte(resp))
-		if err != nil {
-			log.Println("! failed to send cache response:", err.Error())
-			return
-		}
-		log.Println("< response with:", resp)
+	http.Handle(handler_path, handler)         // handle hpc015
+	http.HandleFunc(count_path, count_handler) // handle set/get count
+	http.Handle(stream_path, stream)           // stream occupancy
+	http.Handle(metrics_path, metrics)         // expose metrics to Prometheus
+	http.Handle(devices_path, registry)        // query devices
 
-		// if send successfully, process event
-		for _, data := range cacheReq.Data {
-			counter.Count(data)
-		}
-		return
-	}
+	log.Fatal(http.ListenAndServe(server_host, nil))
 }
 
 func count_handler(w http.ResponseWriter, req *http.Request) {
@@ -163,20 +109,30 @@ func count_handler(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte(strconv.FormatInt(int64(counter.GetOccupants()), 10)))
 
 	case http.MethodPost:
+		// correct occupants, in/out are kept
 		bin, _ := ioutil.ReadAll(req.Body)
 
 		i, err := strconv.ParseInt(string(bin), 10, 64)
-		if err == nil {
-			counter.Set(int(i))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 		log.Println("> request set to:", i)
+
+		_, err = counter.Correct(int(i), req.RemoteAddr, req.URL.Query().Get("reason"))
+		if err != nil {
+			log.Println("! failed to correct:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 	}
 }
 
 // Use hpc015.Default() or implement your own configuration provider.
 // When you write Clock, mind not to set Year/Month/Day as 0.
-func obtainConf() hpc015.Configuration {
-	return hpc015.Configuration{
+//
+// Returning nil keep device's configuration.
+func obtainConf(serialNumber uint32) *hpc015.Configuration {
+	return &hpc015.Configuration{
 		TimeVerifyMode:        hpc015.Both,
 		Speed:                 hpc015.High,
 		RecordingCycle:        0,
@@ -1,8 +1,12 @@
 #! /bin/sh
 
-# Set current occupants as 3
-curl localhost:8888/cs/count -X POST -d 3
+# Set current occupants as 3, in/out are kept and correction is recorded
+curl "localhost:8888/cs/count?reason=recount" -X POST -d 3
 
 
 # Get current occupants
-curl localhost:8888/cs/count
\ No newline at end of file
+curl localhost:8888/cs/count
+
+
+# Stream occupancy, reconnect with Last-Event-ID header to receive missed updates
+curl -N localhost:8888/cs/stream
@@ -0,0 +1,121 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FocusEvent represent focus of device changed.
+//
+// FocusOut means infrared transmitter and receiver are misaligned,
+// and counts during that time are unreliable.
+type FocusEvent struct {
+	SerialNumber uint32
+	Time         time.Time // event time of data, or received time of status
+	Previous     Focus
+	Focus        Focus
+}
+
+// Focused returns whether event recorded while transmitter and receiver aligned.
+// Reports can exclude or flag events not focused.
+func (e Event) Focused() bool {
+	return e.Focus == Focused
+}
+
+// FilterFocused returns events recorded while focused only.
+func FilterFocused(events []Event) []Event {
+	focused := make([]Event, 0, len(events))
+	for _, e := range events {
+		if e.Focused() {
+			focused = append(focused, e)
+		}
+	}
+	return focused
+}
+
+// FocusMonitor track focus of devices, and alert when it changed.
+//
+// Focus reported by both DeviceStatus and CacheData,
+// data are observed in order of event time, then status at received time.
+//
+// Give it to Handler.Focus. ObserveCache of nil FocusMonitor does nothing.
+type FocusMonitor struct {
+	callback func(FocusEvent)
+	states   map[uint32]focusState
+	mux      *sync.Mutex
+}
+
+type focusState struct {
+	focus Focus
+	since time.Time
+}
+
+// NewFocusMonitor create FocusMonitor.
+//
+// `callback` called whenever focus of device changed,
+// including back to Focused. Device first seen as FocusOut also alerted.
+func NewFocusMonitor(callback func(FocusEvent)) *FocusMonitor {
+	return &FocusMonitor{
+		callback: callback,
+		states:   make(map[uint32]focusState),
+		mux:      &sync.Mutex{},
+	}
+}
+
+// ObserveCache record focus of status and events of cache request.
+func (m *FocusMonitor) ObserveCache(status *DeviceStatus, events []Event, received time.Time) {
+	if m == nil {
+		return
+	}
+
+	sorted := make([]Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].EventTime.Before(sorted[j].EventTime)
+	})
+
+	var changes []FocusEvent
+
+	m.mux.Lock()
+	observe := func(focus Focus, t time.Time) {
+		state, ok := m.states[status.SerialNumber]
+		if ok && state.focus == focus {
+			return
+		}
+		if ok || focus == FocusOut {
+			changes = append(changes, FocusEvent{
+				SerialNumber: status.SerialNumber,
+				Time:         t,
+				Previous:     state.focus,
+				Focus:        focus,
+			})
+		}
+		m.states[status.SerialNumber] = focusState{focus, t}
+	}
+	for _, e := range sorted {
+		observe(e.Focus, e.EventTime)
+	}
+	observe(status.Focus, received)
+	m.mux.Unlock()
+
+	for _, e := range changes {
+		debugf("- focus of %s: %v -> %v\n", SerialString(e.SerialNumber), e.Previous, e.Focus)
+		if m.callback != nil {
+			m.callback(e)
+		}
+	}
+}
+
+// Focus returns current focus of device, and since when.
+// If device never observed, returns false.
+func (m *FocusMonitor) Focus(serialNumber uint32) (Focus, time.Time, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	state, ok := m.states[serialNumber]
+	return state.focus, state.since, ok
+}
@@ -0,0 +1,44 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFocusMonitor(t *testing.T) {
+	var changes []FocusEvent
+	m := NewFocusMonitor(func(e FocusEvent) {
+		changes = append(changes, e)
+	})
+
+	at := func(second int) time.Time {
+		return time.Date(2021, 5, 13, 13, 51, second, 0, time.Local)
+	}
+	status := &DeviceStatus{SerialNumber: 1, Focus: Focused}
+
+	m.ObserveCache(status, []Event{
+		{SerialNumber: 1, EventTime: at(3), Focus: Focused},
+		{SerialNumber: 1, EventTime: at(1), Focus: Focused},
+		{SerialNumber: 1, EventTime: at(2), Focus: FocusOut},
+	}, at(10))
+
+	// 1: Focused, 2: FocusOut, 3: Focused, status: Focused
+	if len(changes) != 2 {
+		t.Fatalf("changes = %v, want 2 changes", changes)
+	}
+	if changes[0].Focus != FocusOut || !changes[0].Time.Equal(at(2)) || changes[1].Focus != Focused {
+		t.Errorf("changes = %v, want FocusOut at 2, then Focused", changes)
+	}
+
+	if focus, since, ok := m.Focus(1); !ok || focus != Focused || !since.Equal(at(3)) {
+		t.Errorf("Focus() = %v, %v, %v, want Focused since 3", focus, since, ok)
+	}
+
+	events := FilterFocused([]Event{{Focus: Focused}, {Focus: FocusOut}})
+	if len(events) != 1 {
+		t.Errorf("FilterFocused() = %v, want one event", events)
+	}
+}
@@ -0,0 +1,75 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding"
+)
+
+// Every frame implements encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+//
+// MarshalBinary calculate crc again, and UnmarshalBinary verify it,
+// except DeviceStatus, which crc written and read as it is.
+var (
+	_ encoding.BinaryMarshaler   = GetSettingRequest{}
+	_ encoding.BinaryUnmarshaler = &GetSettingRequest{}
+	_ encoding.BinaryMarshaler   = GetSettingResponse{}
+	_ encoding.BinaryUnmarshaler = &GetSettingResponse{}
+	_ encoding.BinaryMarshaler   = CacheData{}
+	_ encoding.BinaryUnmarshaler = &CacheData{}
+	_ encoding.BinaryMarshaler   = CacheResponse{}
+	_ encoding.BinaryUnmarshaler = &CacheResponse{}
+	_ encoding.BinaryMarshaler   = DeviceStatus{}
+	_ encoding.BinaryUnmarshaler = &DeviceStatus{}
+)
+
+// MarshalBinary is same as Binary.
+func (request GetSettingRequest) MarshalBinary() ([]byte, error) {
+	return request.Binary()
+}
+
+// UnmarshalBinary is same as NewSettingRequest, but it copy `data`.
+func (request *GetSettingRequest) UnmarshalBinary(data []byte) error {
+	return request.decode(append([]byte(nil), data...))
+}
+
+// MarshalBinary is same as Binary.
+func (response GetSettingResponse) MarshalBinary() ([]byte, error) {
+	return response.Binary()
+}
+
+// UnmarshalBinary is same as NewGetSettingResponse, but it copy `data`.
+func (response *GetSettingResponse) UnmarshalBinary(data []byte) error {
+	return response.decode(append([]byte(nil), data...))
+}
+
+// MarshalBinary is same as Binary.
+func (data CacheData) MarshalBinary() ([]byte, error) {
+	return data.Binary()
+}
+
+// UnmarshalBinary is same as NewCacheData.
+func (data *CacheData) UnmarshalBinary(bin []byte) error {
+	return data.decode(bin)
+}
+
+// MarshalBinary is same as Binary.
+func (response CacheResponse) MarshalBinary() ([]byte, error) {
+	return response.Binary()
+}
+
+// UnmarshalBinary is same as NewCacheResponse.
+func (response *CacheResponse) UnmarshalBinary(data []byte) error {
+	return response.decode(data)
+}
+
+// MarshalBinary is same as Binary.
+func (status DeviceStatus) MarshalBinary() ([]byte, error) {
+	return status.Binary()
+}
+
+// UnmarshalBinary is same as NewDeviceStatus, but takes binary instead of hex.
+func (status *DeviceStatus) UnmarshalBinary(data []byte) error {
+	return status.decode(data)
+}
@@ -0,0 +1,144 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// withCrc append crc of `data`, as device and server do
+func withCrc(data []byte) []byte {
+	h := NewCrc16()
+	h.Write(data)
+	return h.Sum(data)
+}
+
+// roundTrip unmarshal `frame` into `v`, then marshal it again
+func roundTrip(v interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}, frame []byte) bool {
+	if err := v.UnmarshalBinary(frame); err != nil {
+		return false
+	}
+	got, err := v.MarshalBinary()
+	return err == nil && bytes.Equal(got, frame)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		f    interface{}
+	}{
+		{"GetSettingRequest", func(b [51]byte) bool {
+			return roundTrip(&GetSettingRequest{}, withCrc(b[:]))
+		}},
+		{"GetSettingResponse", func(b [56]byte) bool {
+			return roundTrip(&GetSettingResponse{}, withCrc(b[:]))
+		}},
+		{"CacheData", func(b [15]byte) bool {
+			return roundTrip(&CacheData{}, withCrc(b[:]))
+		}},
+		{"CacheResponse", func(b [15]byte) bool {
+			return roundTrip(&CacheResponse{}, withCrc(b[:]))
+		}},
+		{"DeviceStatus", func(b [14]byte) bool {
+			return roundTrip(&DeviceStatus{}, b[:])
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := quick.Check(tt.f, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestFrameStructRoundTrip(t *testing.T) {
+	// crc is calculated by MarshalBinary, so it is not compared
+	tests := []struct {
+		name string
+		f    interface{}
+	}{
+		{"CacheData", func(want CacheData) bool {
+			bin, err := want.MarshalBinary()
+			var got CacheData
+			if err != nil || got.UnmarshalBinary(bin) != nil {
+				return false
+			}
+			want.Crc16 = binary.BigEndian.Uint16(bin[15:])
+			return reflect.DeepEqual(got, want)
+		}},
+		{"CacheResponse", func(want CacheResponse) bool {
+			bin, err := want.MarshalBinary()
+			var got CacheResponse
+			if err != nil || got.UnmarshalBinary(bin) != nil {
+				return false
+			}
+			want.Crc16 = binary.BigEndian.Uint16(bin[15:])
+			return reflect.DeepEqual(got, want)
+		}},
+		{"DeviceStatus", func(want DeviceStatus) bool {
+			bin, err := want.MarshalBinary()
+			var got DeviceStatus
+			if err != nil || got.UnmarshalBinary(bin) != nil {
+				return false
+			}
+			return reflect.DeepEqual(got, want)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := quick.Check(tt.f, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBinaryError(t *testing.T) {
+	frame := withCrc(make([]byte, 15))
+	frame[16] ^= 0xFF
+
+	tests := []struct {
+		name string
+		v    encoding.BinaryUnmarshaler
+		data []byte
+	}{
+		{"GetSettingRequest", &GetSettingRequest{}, make([]byte, 52)},
+		{"GetSettingResponse", &GetSettingResponse{}, make([]byte, 57)},
+		{"CacheData", &CacheData{}, frame},
+		{"CacheResponse", &CacheResponse{}, frame},
+		{"DeviceStatus", &DeviceStatus{}, make([]byte, 13)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.v.UnmarshalBinary(tt.data); err == nil {
+				t.Errorf("UnmarshalBinary() error = %v, want error", err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBinaryCopy(t *testing.T) {
+	frame := withCrc(make([]byte, 51))
+	var request GetSettingRequest
+	if err := request.UnmarshalBinary(frame); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+
+	frame[0] = 0xFF
+	if request.SerialNumber[0] != 0 {
+		t.Errorf("SerialNumber = %X, must not refer given data", request.SerialNumber)
+	}
+}
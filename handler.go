@@ -0,0 +1,272 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeTolerance is used when Handler.TimeTolerance is 0.
+const DefaultTimeTolerance = 5 * time.Minute
+
+// Handler handle requests from hpc015, implements http.Handler.
+//
+// Register it on path you configured on device, for example:
+//
+//	http.Handle("/cs", &hpc015.Handler{Store: store, Counter: counter})
+//
+// Data of cache request persisted before response,
+// and if persisting failed, Handler answer with Failed,
+// so device keep its cache and retry later.
+type Handler struct {
+	// Configuration returns configuration for device of `serialNumber`.
+	// If it is nil or returns nil, getsetting answered with device's own configuration.
+	//
+	// Cache response always carry system time and business hours.
+	// Without configuration, they are taken from configuration read back by Registry,
+	// or Default() if device not known yet.
+	Configuration func(serialNumber uint32) *Configuration
+
+	// SystemTime of device is corrected only when it differ more than TimeTolerance.
+	//
+	// DO NOT change configuration every time.
+	// When configuration modified, device send request to confirm,
+	// and if system time changed again, device send confirmation again. It is loop.
+	TimeTolerance time.Duration
+
+	// Store, if not nil, every data of cache request appended before response.
+	Store EventStore
+
+	// Counter, if not nil, count data of all devices after persisted.
+	Counter *counter
+
+	// Zones maps device to zone, for Counters and Aggregator.
+	Zones ZoneMap
+
+	// Counters is counter of each zone, and data of device counted by counter of its zone.
+	// Zone not in Counters is not counted.
+	Counters Counters
+
+	// Aggregator, if not nil, aggregate data of cache request after counted.
+	// When any counter is set, duplicated data not aggregated.
+	Aggregator *Aggregator
+
+	// Metrics, if not nil, collect statistics of requests and devices.
+	Metrics *Metrics
+
+	// Registry, if not nil, record last known status of devices.
+	Registry *Registry
+
+	// Battery, if not nil, monitor battery of devices.
+	Battery *BatteryMonitor
+
+	// Focus, if not nil, track focus of devices.
+	Focus *FocusMonitor
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	bin, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		debugf("! failed to read request: %s\n", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	debugf("> request from: %s %s\n", req.RemoteAddr, bin)
+
+	requestSchema, err := NewRequestSchema(string(bin))
+	if err != nil {
+		debugf("! failed to parse RequestSchema: %s\n", err.Error())
+		h.Metrics.parseFailure("schema", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.Metrics.request(requestSchema.Cmd)
+
+	var resp []byte
+	switch requestSchema.Cmd {
+	case "getsetting":
+		resp, err = h.getSetting(requestSchema, req.RemoteAddr)
+	case "cache":
+		resp, err = h.cache(requestSchema, req.RemoteAddr)
+	default:
+		err = fmt.Errorf("unknown command: %s", requestSchema.Cmd)
+		h.Metrics.parseFailure("cmd", err)
+	}
+	if err != nil {
+		debugf("! %s\n", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	debugf("< response with: %s\n", resp)
+	if _, err := w.Write(resp); err != nil {
+		debugf("! failed to send response: %s\n", err.Error())
+	}
+}
+
+// getSetting build response of getsetting request, with configuration applied
+func (h *Handler) getSetting(requestSchema *RequestSchema, remoteAddr string) ([]byte, error) {
+	// getsetting has one data field
+	setReq, err := NewSettingRequest(requestSchema.Data[0])
+	if err != nil {
+		h.Metrics.parseFailure("getsetting", err)
+		return nil, fmt.Errorf("failed to parse SettingRequest: %w", err)
+	}
+	h.Registry.ObserveSetting(setReq, remoteAddr, time.Now())
+
+	// new response based on request
+	setResp := setReq.Response(requestSchema.Flag)
+
+	if base := h.configuration(setReq.Serial()); base != nil {
+		conf := *base
+
+		// keep device's system time, if it is close enough
+		current := setResp.GetConfiguration()
+		if math.Abs(current.SystemTime.Sub(conf.SystemTime).Minutes()) <= h.timeTolerance().Minutes() {
+			conf.SystemTime = current.SystemTime
+		}
+
+		if _, err := setResp.SetConfiguration(conf); err != nil {
+			return nil, fmt.Errorf("failed to set configuration: %s", err.Error())
+		}
+	}
+
+	bin, err := setResp.Binary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert binary: %s", err.Error())
+	}
+	return []byte(fmt.Sprintf("result=%X", bin)), nil
+}
+
+// cache persist data of cache request, and build response.
+//
+// Response answer OK only if data persisted.
+func (h *Handler) cache(requestSchema *RequestSchema, remoteAddr string) ([]byte, error) {
+	cacheReq, err := NewCacheRequest(requestSchema)
+	if err != nil {
+		h.Metrics.parseFailure("cache", err)
+		return nil, fmt.Errorf("failed to parse CacheRequest: %w", err)
+	}
+	received := time.Now()
+	h.Registry.ObserveCache(cacheReq.Status, remoteAddr, received)
+	h.Battery.ObserveCache(cacheReq.Status, received)
+
+	answer := OK
+	if err := h.persist(cacheReq, received); err != nil {
+		debugf("! failed to persist cache: %s\n", err.Error())
+		answer = Failed
+	}
+
+	conf := h.cacheConfiguration(cacheReq.Status.SerialNumber, received)
+	cacheResp := cacheReq.Response(answer, requestSchema.Flag, *conf)
+	bin, err := cacheResp.Binary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert binary: %s", err.Error())
+	}
+	return []byte(fmt.Sprintf("result=%X", bin)), nil
+}
+
+// persist write data of cache request to store, then count and aggregate it
+func (h *Handler) persist(cacheReq *CacheRequest, received time.Time) error {
+	events := make([]Event, 0, len(cacheReq.Data))
+	for _, data := range cacheReq.Data {
+		events = append(events, NewEvent(cacheReq.Status.SerialNumber, data, received))
+	}
+
+	if h.Store != nil {
+		if err := h.Store.Append(events...); err != nil {
+			return err
+		}
+	}
+
+	// events not duplicated
+	fresh := events
+	counters := h.counters(cacheReq.Status.SerialNumber)
+	if len(counters) != 0 {
+		fresh = make([]Event, 0, len(events))
+		for i, data := range cacheReq.Data {
+			counted := false
+			for _, c := range counters {
+				if c.CountFrom(cacheReq.Status.SerialNumber, data) != nil {
+					counted = true
+				}
+			}
+			if counted {
+				fresh = append(fresh, events[i])
+			} else {
+				h.Metrics.duplicate()
+			}
+		}
+	}
+
+	if h.Aggregator != nil {
+		h.Aggregator.Add(fresh...)
+	}
+	h.Metrics.ObserveCache(cacheReq.Status, fresh, received)
+	h.Focus.ObserveCache(cacheReq.Status, fresh, received)
+	return nil
+}
+
+// counters returns counters, which count data of device
+func (h *Handler) counters(serialNumber uint32) []*counter {
+	var counters []*counter
+	if h.Counter != nil {
+		counters = append(counters, h.Counter)
+	}
+	if c, ok := h.Counters[h.zone(serialNumber)]; ok {
+		counters = append(counters, c)
+	}
+	return counters
+}
+
+// zone returns zone of device, or SerialString if device not in Zones
+func (h *Handler) zone(serialNumber uint32) string {
+	if zone := h.Zones.Zone(serialNumber); zone != "" {
+		return zone
+	}
+	return SerialString(serialNumber)
+}
+
+func (h *Handler) configuration(serialNumber uint32) *Configuration {
+	if h.Configuration == nil {
+		return nil
+	}
+	return h.Configuration(serialNumber)
+}
+
+// cacheConfiguration returns configuration to answer cache request.
+//
+// Without configuration, device's own configuration is used,
+// with system time advanced since it read back.
+func (h *Handler) cacheConfiguration(serialNumber uint32, received time.Time) *Configuration {
+	if conf := h.configuration(serialNumber); conf != nil {
+		return conf
+	}
+	if h.Registry != nil {
+		if d, ok := h.Registry.Device(serialNumber); ok && d.Configuration != nil {
+			conf := *d.Configuration
+			conf.SystemTime = conf.SystemTime.Add(received.Sub(d.LastGetSetting))
+			return &conf
+		}
+	}
+	return Default()
+}
+
+func (h *Handler) timeTolerance() time.Duration {
+	if h.TimeTolerance == 0 {
+		return DefaultTimeTolerance
+	}
+	return h.TimeTolerance
+}
+
+// debugf write message to DebugOutput when EnableDebugMessage is set
+func debugf(format string, a ...interface{}) {
+	if EnableDebugMessage {
+		fmt.Fprintf(DebugOutput, format, a...)
+	}
+}
@@ -0,0 +1,124 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testSettingRequest = "cmd=getsetting&flag=0002&data=0D3BB382030000000000000000000000000002085DDD5A75CBDC0A5DDD5A75CBDC909F33173CE4DA0F0101000002010000173BECE4"
+	testCacheRequest   = "cmd=cache&flag=0002&status=010142AE51520156000D0001E6A7&count=2&data=15050D0D332A000100000000000000E97E&data=15050D0D332C000000000001000000C65E"
+)
+
+func serve(h *Handler, body string) string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/cs", strings.NewReader(body)))
+	return rec.Body.String()
+}
+
+func TestHandlerGetSetting(t *testing.T) {
+	h := &Handler{}
+
+	got := serve(h, testSettingRequest)
+	// Confirmation, with flag reversed
+	if !strings.HasPrefix(got, "result=050200") {
+		t.Errorf("ServeHTTP() = %s, want prefix %s", got, "result=050200")
+	}
+
+	h.Configuration = func(serialNumber uint32) *Configuration {
+		if serialNumber != 0x0D3BB382 {
+			t.Errorf("Configuration() serialNumber = %X, want %X", serialNumber, 0x0D3BB382)
+		}
+		conf := Default()
+		conf.Speed = High
+		return conf
+	}
+	got = serve(h, testSettingRequest)
+	if !strings.HasPrefix(got, "result=040200") {
+		t.Errorf("ServeHTTP() = %s, want prefix %s", got, "result=040200")
+	}
+}
+
+func TestHandlerCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	s, err := OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	c := Counter()
+	defer c.Close()
+	h := &Handler{Store: s, Counter: c}
+
+	if got := serve(h, testCacheRequest); !strings.HasPrefix(got, "result=01") {
+		t.Errorf("ServeHTTP() = %s, want OK", got)
+	}
+	if in, out := c.GetInOut(); in != 1 || out != 1 {
+		t.Errorf("GetInOut() = %d, %d, want %d, %d", in, out, 1, 1)
+	}
+
+	// failed to persist, data must not be counted
+	s.Close()
+	c2 := Counter()
+	defer c2.Close()
+	h.Counter = c2
+	if got := serve(h, testCacheRequest); !strings.HasPrefix(got, "result=00") {
+		t.Errorf("ServeHTTP() = %s, want Failed", got)
+	}
+	if in, out := c2.GetInOut(); in != 0 || out != 0 {
+		t.Errorf("GetInOut() = %d, %d, want %d, %d", in, out, 0, 0)
+	}
+
+	events, err := ReadEventLog(path)
+	if err != nil {
+		t.Fatalf("ReadEventLog() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("ReadEventLog() = %d events, want %d", len(events), 2)
+	}
+}
+
+func TestHandlerCacheConfiguration(t *testing.T) {
+	h := &Handler{Registry: NewRegistry()}
+
+	// unknown device answered with default
+	resp, err := ParseCacheResponse(serve(h, testCacheRequest))
+	if err != nil {
+		t.Fatalf("ParseCacheResponse() error = %v", err)
+	}
+	if resp.OpenHour != 0 || resp.CloseHour != 23 {
+		t.Errorf("business hours = %d-%d, want %d-%d", resp.OpenHour, resp.CloseHour, 0, 23)
+	}
+
+	// device's own configuration, read back by getsetting
+	schema, err := NewRequestSchema(testSettingRequest)
+	if err != nil {
+		t.Fatalf("NewRequestSchema() error = %v", err)
+	}
+	req, err := NewSettingRequest(schema.Data[0])
+	if err != nil {
+		t.Fatalf("NewSettingRequest() error = %v", err)
+	}
+	req.SerialNumber = []byte{0x42, 0xAE, 0x51, 0x52}
+	req.OpenHour, req.OpenMinute, req.CloseHour, req.CloseMinute = 9, 30, 18, 0
+	body, err := req.Body(0x0002)
+	if err != nil {
+		t.Fatalf("Body() error = %v", err)
+	}
+	serve(h, body)
+
+	resp, err = ParseCacheResponse(serve(h, testCacheRequest))
+	if err != nil {
+		t.Fatalf("ParseCacheResponse() error = %v", err)
+	}
+	if resp.OpenHour != 9 || resp.OpenMinute != 30 || resp.CloseHour != 18 || resp.CloseMinute != 0 {
+		t.Errorf("business hours = %d:%d-%d:%d, want %d:%d-%d:%d", resp.OpenHour, resp.OpenMinute, resp.CloseHour, resp.CloseMinute, 9, 30, 18, 0)
+	}
+	if resp.Year != req.Year || resp.Month != req.Month || resp.Day != req.Day {
+		t.Errorf("system date = %d-%d-%d, want %d-%d-%d", resp.Year, resp.Month, resp.Day, req.Year, req.Month, req.Day)
+	}
+}
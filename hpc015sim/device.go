@@ -0,0 +1,304 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hpc015sim emulates hpc015 device, to test server without real hardware.
+//
+// A simulated Device hold its own configuration, send getsetting and cache
+// requests over HTTP like real device, and apply configuration sent by server.
+//
+//	device := hpc015sim.New("http://localhost:8888/cs", 0x42AE5152)
+//	device.Record(time.Now(), 1, 0)
+//	err := device.Sync(ctx)
+package hpc015sim
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+// maxConfirmation is number of getsetting round trip,
+// until server confirm configuration.
+const maxConfirmation = 3
+
+// Device is simulated hpc015.
+type Device struct {
+	URL          string // server url, same as configured on real device
+	SerialNumber uint32
+	Version      uint16
+	MacAddress1  []byte // 7 bytes
+	MacAddress2  []byte // 7 bytes
+	MacAddress3  []byte // 7 bytes
+
+	TransmitterBAT byte
+	CounterBAT     byte
+	Charge         hpc015.Charge
+	Focus          hpc015.Focus
+
+	Client *http.Client
+
+	conf        hpc015.Configuration
+	clockOffset time.Duration       // difference between system time of device and real time
+	buffer      []*hpc015.CacheData // recorded, not uploaded yet
+	mux         *sync.Mutex
+}
+
+// New create simulated device with default configuration,
+// which send requests to `url`.
+func New(url string, serialNumber uint32) *Device {
+	return &Device{
+		URL:            url,
+		SerialNumber:   serialNumber,
+		Version:        0x0101,
+		MacAddress1:    make([]byte, 7),
+		MacAddress2:    make([]byte, 7),
+		MacAddress3:    make([]byte, 7),
+		TransmitterBAT: 100,
+		CounterBAT:     100,
+		Charge:         hpc015.NotCharged,
+		Focus:          hpc015.Focused,
+		Client:         http.DefaultClient,
+		conf:           *hpc015.Default(),
+		mux:            &sync.Mutex{},
+	}
+}
+
+// Configuration returns current configuration of device.
+// SystemTime is current time of device.
+func (d *Device) Configuration() hpc015.Configuration {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	conf := d.conf
+	conf.SystemTime = d.now()
+	return conf
+}
+
+// SetConfiguration set configuration of device, as configured on device by hand.
+func (d *Device) SetConfiguration(conf hpc015.Configuration) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.conf = conf
+	d.clockOffset = time.Until(conf.SystemTime)
+}
+
+// now returns system time of device, caller must hold lock
+func (d *Device) now() time.Time {
+	return time.Now().Add(d.clockOffset)
+}
+
+// Record buffer in/out counted at `t`, until uploaded.
+func (d *Device) Record(t time.Time, in, out uint32) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.buffer = append(d.buffer, &hpc015.CacheData{
+		Year:    byte(t.Year() % 2000),
+		Month:   byte(t.Month()),
+		Day:     byte(t.Day()),
+		Hour:    byte(t.Hour()),
+		Minute:  byte(t.Minute()),
+		Secound: byte(t.Second()),
+		Focus:   d.Focus,
+		DxIn:    in,
+		Dxout:   out,
+	})
+}
+
+// Pending returns number of recorded data, not uploaded yet.
+func (d *Device) Pending() int {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return len(d.buffer)
+}
+
+// Sync send getsetting, and upload recorded data, as device do every upload cycle.
+func (d *Device) Sync(ctx context.Context) error {
+	if err := d.GetSetting(ctx); err != nil {
+		return err
+	}
+	return d.Upload(ctx)
+}
+
+// Run Sync every upload cycle, or every `realtime` if device upload in real-time, until `ctx` done.
+func (d *Device) Run(ctx context.Context, realtime time.Duration) error {
+	for {
+		if err := d.Sync(ctx); err != nil && ctx.Err() == nil {
+			// device retry on next cycle, as real one
+			if hpc015.EnableDebugMessage {
+				fmt.Fprintf(hpc015.DebugOutput, "! simulator %08X: %s\n", d.SerialNumber, err.Error())
+			}
+		}
+
+		interval := time.Duration(d.Configuration().UploadCycle) * time.Minute
+		if interval == 0 {
+			interval = realtime
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// GetSetting send getsetting request, and apply configuration of response.
+//
+// When server send new parameter, device apply it and send getsetting again to confirm,
+// until server respond with confirmation.
+func (d *Device) GetSetting(ctx context.Context) error {
+	for i := 0; i < maxConfirmation; i++ {
+		d.mux.Lock()
+		body, err := d.settingBody()
+		d.mux.Unlock()
+		if err != nil {
+			return err
+		}
+
+		result, err := d.post(ctx, body)
+		if err != nil {
+			return err
+		}
+		resp, err := hpc015.ParseGetSettingResponse(result)
+		if err != nil {
+			return err
+		}
+		if resp.RespondingType == hpc015.Confirmation {
+			return nil
+		}
+
+		d.mux.Lock()
+		d.apply(resp)
+		d.mux.Unlock()
+	}
+	return errors.New("failed to get setting: server not confirmed configuration")
+}
+
+// Upload send recorded data by cache request.
+//
+// Data removed only when server answer OK, otherwise kept to retry.
+func (d *Device) Upload(ctx context.Context) error {
+	d.mux.Lock()
+	data := append([]*hpc015.CacheData(nil), d.buffer...)
+	body, err := d.cacheBody(data)
+	d.mux.Unlock()
+
+	if len(data) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := d.post(ctx, body)
+	if err != nil {
+		return err
+	}
+	resp, err := hpc015.ParseCacheResponse(result)
+	if err != nil {
+		return err
+	}
+	if resp.AnswerType != hpc015.OK {
+		return fmt.Errorf("failed to upload: server answered %v", resp.AnswerType)
+	}
+
+	// data recorded while uploading are kept
+	d.mux.Lock()
+	d.buffer = d.buffer[len(data):]
+	d.mux.Unlock()
+	return nil
+}
+
+// post send body, and returns body of response
+func (d *Device) post(ctx context.Context, body string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	bin, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server responded %s", resp.Status)
+	}
+	return string(bin), nil
+}
+
+// settingBody build getsetting request with current configuration, caller must hold lock
+func (d *Device) settingBody() (string, error) {
+	now := d.now()
+	conf := d.conf
+
+	serialNumber := make([]byte, 4)
+	binary.BigEndian.PutUint32(serialNumber, d.SerialNumber)
+
+	request := hpc015.GetSettingRequest{
+		SerialNumber:    serialNumber,
+		TimeVerifyMode:  conf.TimeVerifyMode,
+		Speed:           conf.Speed,
+		RecordingCycle:  conf.RecordingCycle,
+		UploadCycle:     conf.UploadCycle,
+		FixedTimeUpload: conf.EnableFixedTimeUpload,
+		UploadHour1:     byte(conf.UploadClock.Hour()),
+		UploadMinute1:   byte(conf.UploadClock.Minute()),
+		NetworkType:     conf.NetworkType,
+		DisplayType:     conf.DisplayType,
+		MacAddress1:     d.MacAddress1,
+		MacAddress2:     d.MacAddress2,
+		MacAddress3:     d.MacAddress3,
+		Year:            byte(now.Year() % 2000),
+		Month:           byte(now.Month()),
+		Day:             byte(now.Day()),
+		Hour:            byte(now.Hour()),
+		Minute:          byte(now.Minute()),
+		Second:          byte(now.Second()),
+		Week:            byte(now.Weekday()),
+		OpenHour:        byte(conf.OpenClock.Hour()),
+		OpenMinute:      byte(conf.OpenClock.Minute()),
+		CloseHour:       byte(conf.CloseClock.Hour()),
+		CloseMinute:     byte(conf.CloseClock.Minute()),
+	}
+	return request.Body(hpc015.NewFlag(now))
+}
+
+// cacheBody build cache request with `data`, caller must hold lock
+func (d *Device) cacheBody(data []*hpc015.CacheData) (string, error) {
+	request := hpc015.CacheRequest{
+		Status: &hpc015.DeviceStatus{
+			Version:        d.Version,
+			SerialNumber:   d.SerialNumber,
+			Focus:          d.Focus,
+			TransmitterBAT: d.TransmitterBAT,
+			CounterBAT:     d.CounterBAT,
+			Charge:         d.Charge,
+		},
+		Data: data,
+	}
+	return request.Body(hpc015.NewFlag(d.now()))
+}
+
+// apply parameters of response to configuration, caller must hold lock
+func (d *Device) apply(resp *hpc015.GetSettingResponse) {
+	d.conf = *resp.GetConfiguration()
+	d.clockOffset = time.Until(d.conf.SystemTime)
+	if hpc015.EnableDebugMessage {
+		fmt.Fprintf(hpc015.DebugOutput, "- simulator %08X: configuration applied\n", d.SerialNumber)
+	}
+}
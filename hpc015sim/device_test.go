@@ -0,0 +1,205 @@
+package hpc015sim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cmsong-shina/hpc015"
+)
+
+// failingStore fail to append, while fail is set
+type failingStore struct {
+	*hpc015.MemoryStore
+	mux  sync.Mutex
+	fail bool
+}
+
+func (s *failingStore) Append(events ...hpc015.Event) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Append(events...)
+}
+
+func (s *failingStore) setFail(fail bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.fail = fail
+}
+
+// countingHandler count commands sent to handler
+type countingHandler struct {
+	http.Handler
+	mux  sync.Mutex
+	cmds map[string]int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	h.mux.Lock()
+	if h.cmds == nil {
+		h.cmds = make(map[string]int)
+	}
+	h.cmds[strings.SplitN(strings.TrimPrefix(string(body), "cmd="), "&", 2)[0]]++
+	h.mux.Unlock()
+
+	h.Handler.ServeHTTP(w, req)
+}
+
+func (h *countingHandler) count(cmd string) int {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.cmds[cmd]
+}
+
+func TestDeviceGetSetting(t *testing.T) {
+	conf := *hpc015.Default()
+	conf.Speed = hpc015.High
+	conf.UploadCycle = 10
+	conf.OpenClock = time.Date(1, 1, 1, 9, 0, 0, 0, time.Local)
+	conf.CloseClock = time.Date(1, 1, 1, 18, 30, 0, 0, time.Local)
+
+	h := &countingHandler{Handler: &hpc015.Handler{
+		Configuration: func(uint32) *hpc015.Configuration {
+			c := conf
+			c.SystemTime = time.Now()
+			return &c
+		},
+	}}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	device := New(server.URL, 0x42AE5152)
+	if err := device.GetSetting(context.Background()); err != nil {
+		t.Fatalf("GetSetting() error = %v", err)
+	}
+
+	got := device.Configuration()
+	if got.Speed != hpc015.High || got.UploadCycle != 10 {
+		t.Errorf("Configuration() = %v, want speed %v, upload cycle %v", got, hpc015.High, 10)
+	}
+	if got.OpenClock.Hour() != 9 || got.CloseClock.Hour() != 18 || got.CloseClock.Minute() != 30 {
+		t.Errorf("Configuration() business hours = %v - %v, want 09:00 - 18:30", got.OpenClock, got.CloseClock)
+	}
+	// new parameter, then confirmation
+	if got := h.count("getsetting"); got != 2 {
+		t.Errorf("getsetting sent %v times, want %v", got, 2)
+	}
+
+	// already configured, confirmed at once
+	if err := device.GetSetting(context.Background()); err != nil {
+		t.Fatalf("GetSetting() error = %v", err)
+	}
+	if got := h.count("getsetting"); got != 3 {
+		t.Errorf("getsetting sent %v times, want %v", got, 3)
+	}
+}
+
+func TestDeviceGetSettingNotConfirmed(t *testing.T) {
+	// system time always changed, server never confirm
+	shift := 0
+	server := httptest.NewServer(&hpc015.Handler{
+		Configuration: func(uint32) *hpc015.Configuration {
+			shift++
+			c := hpc015.Default()
+			c.SystemTime = time.Now().Add(time.Duration(shift) * time.Hour)
+			return c
+		},
+	})
+	defer server.Close()
+
+	device := New(server.URL, 0x42AE5152)
+	if err := device.GetSetting(context.Background()); err == nil {
+		t.Errorf("GetSetting() error = %v, want error", err)
+	}
+}
+
+func TestDeviceUpload(t *testing.T) {
+	store := &failingStore{MemoryStore: hpc015.NewMemoryStore()}
+	counter := hpc015.Counter()
+	defer counter.Close()
+
+	server := httptest.NewServer(&hpc015.Handler{Store: store, Counter: counter})
+	defer server.Close()
+
+	device := New(server.URL, 0x42AE5152)
+	now := time.Now()
+	device.Record(now.Add(-2*time.Second), 2, 0)
+	device.Record(now.Add(-time.Second), 0, 1)
+
+	if err := device.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got := device.Pending(); got != 0 {
+		t.Errorf("Pending() = %v, want %v", got, 0)
+	}
+	if in, out := counter.GetInOut(); in != 2 || out != 1 {
+		t.Errorf("GetInOut() = %v, %v, want %v, %v", in, out, 2, 1)
+	}
+	events, err := store.Range(0x42AE5152, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil || len(events) != 2 {
+		t.Errorf("Range() = %v, %v, want 2 events", events, err)
+	}
+
+	// nothing to upload
+	if err := device.Upload(context.Background()); err != nil {
+		t.Errorf("Upload() error = %v", err)
+	}
+}
+
+func TestDeviceUploadBuffered(t *testing.T) {
+	store := &failingStore{MemoryStore: hpc015.NewMemoryStore()}
+	counter := hpc015.Counter()
+	defer counter.Close()
+
+	server := httptest.NewServer(&hpc015.Handler{Store: store, Counter: counter})
+	defer server.Close()
+
+	device := New(server.URL, 0x42AE5152)
+	now := time.Now()
+	device.Record(now.Add(-3*time.Second), 1, 0)
+
+	// server answer Failed
+	store.setFail(true)
+	if err := device.Upload(context.Background()); err == nil {
+		t.Errorf("Upload() error = %v, want error", err)
+	}
+	if got := device.Pending(); got != 1 {
+		t.Errorf("Pending() = %v, want %v", got, 1)
+	}
+
+	// server down
+	down := New("http://127.0.0.1:1/cs", 0x42AE5152)
+	down.Record(now, 1, 0)
+	if err := down.Upload(context.Background()); err == nil {
+		t.Errorf("Upload() error = %v, want error", err)
+	}
+	if got := down.Pending(); got != 1 {
+		t.Errorf("Pending() = %v, want %v", got, 1)
+	}
+
+	// recovered, buffered data uploaded with new one
+	store.setFail(false)
+	device.Record(now.Add(-2*time.Second), 1, 0)
+	if err := device.Upload(context.Background()); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if got := device.Pending(); got != 0 {
+		t.Errorf("Pending() = %v, want %v", got, 0)
+	}
+	if got := counter.GetOccupants(); got != 2 {
+		t.Errorf("GetOccupants() = %v, want %v", got, 2)
+	}
+}
@@ -0,0 +1,259 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics collect statistics of requests and devices,
+// and expose them in Prometheus text exposition format.
+//
+// Give it to Handler.Metrics, and register it on path such as `/metrics`.
+// Observing with nil Metrics does nothing.
+type Metrics struct {
+	requests      map[string]uint64 // by cmd
+	parseFailures map[string]uint64 // by kind
+	crcFailures   uint64
+	duplicates    uint64
+	devices       map[uint32]*deviceMetrics
+	counters      Counters
+	mux           *sync.Mutex
+}
+
+// deviceMetrics is latest status of a device
+type deviceMetrics struct {
+	in             uint64
+	out            uint64
+	lastUpload     time.Time
+	firmware       string
+	transmitterBAT byte
+	counterBAT     byte
+	charge         Charge
+	focus          Focus
+}
+
+// NewMetrics create empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:      make(map[string]uint64),
+		parseFailures: make(map[string]uint64),
+		devices:       make(map[uint32]*deviceMetrics),
+		mux:           &sync.Mutex{},
+	}
+}
+
+// request count request of `cmd`
+func (m *Metrics) request(cmd string) {
+	if m == nil {
+		return
+	}
+	if cmd != "getsetting" && cmd != "cache" {
+		cmd = "unknown"
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.requests[cmd]++
+}
+
+// parseFailure count failure of parsing `kind` of message
+func (m *Metrics) parseFailure(kind string, err error) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.parseFailures[kind]++
+	if errors.Is(err, ErrInvalidCRC) {
+		m.crcFailures++
+	}
+}
+
+// SetCounters set counters, whose occupants exported by zone.
+func (m *Metrics) SetCounters(counters Counters) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.counters = counters
+}
+
+// duplicate count data, which not counted as duplicated
+func (m *Metrics) duplicate() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.duplicates++
+}
+
+// ObserveCache record status of device and its events, received at `received`.
+//
+// Handler calls this, with events not duplicated.
+func (m *Metrics) ObserveCache(status *DeviceStatus, events []Event, received time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	d, ok := m.devices[status.SerialNumber]
+	if !ok {
+		d = &deviceMetrics{}
+		m.devices[status.SerialNumber] = d
+	}
+	for _, e := range events {
+		d.in += uint64(e.DxIn)
+		d.out += uint64(e.DxOut)
+	}
+	d.lastUpload = received
+	d.firmware = status.Firmware()
+	d.transmitterBAT = status.TransmitterBAT
+	d.counterBAT = status.CounterBAT
+	d.charge = status.Charge
+	d.focus = status.Focus
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := m.WriteTo(w); err != nil {
+		debugf("! failed to write metrics: %s\n", err.Error())
+	}
+}
+
+// WriteTo write metrics in Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+
+	header := func(name, typ, help string) {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("hpc015_requests_total", "counter", "Number of requests by command.")
+	for _, k := range sortedKeys(m.requests) {
+		fmt.Fprintf(cw, "hpc015_requests_total{cmd=%q} %d\n", k, m.requests[k])
+	}
+	header("hpc015_parse_failures_total", "counter", "Number of requests failed to parse, by kind of message.")
+	for _, k := range sortedKeys(m.parseFailures) {
+		fmt.Fprintf(cw, "hpc015_parse_failures_total{kind=%q} %d\n", k, m.parseFailures[k])
+	}
+	header("hpc015_crc_failures_total", "counter", "Number of messages with incorrect crc.")
+	fmt.Fprintf(cw, "hpc015_crc_failures_total %d\n", m.crcFailures)
+	header("hpc015_duplicates_total", "counter", "Number of data not counted as duplicated.")
+	fmt.Fprintf(cw, "hpc015_duplicates_total %d\n", m.duplicates)
+
+	zones := make([]string, 0, len(m.counters))
+	for zone := range m.counters {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	header("hpc015_occupants", "gauge", "Current occupants of zone, including corrections and daily reset.")
+	for _, zone := range zones {
+		fmt.Fprintf(cw, "hpc015_occupants{zone=%q} %d\n", zone, m.counters[zone].GetOccupants())
+	}
+
+	serials := make([]uint32, 0, len(m.devices))
+	for serial := range m.devices {
+		serials = append(serials, serial)
+	}
+	sort.Slice(serials, func(i, j int) bool { return serials[i] < serials[j] })
+
+	gauges := []struct {
+		name  string
+		typ   string
+		help  string
+		value func(d *deviceMetrics) string
+	}{
+		{"hpc015_device_in_total", "counter", "Cumulative number of in.", func(d *deviceMetrics) string {
+			return fmt.Sprint(d.in)
+		}},
+		{"hpc015_device_out_total", "counter", "Cumulative number of out.", func(d *deviceMetrics) string {
+			return fmt.Sprint(d.out)
+		}},
+		{"hpc015_device_net_count", "gauge", "Cumulative in minus out since server started. It is not occupants, corrections and daily resets are not applied.", func(d *deviceMetrics) string {
+			return fmt.Sprint(int64(d.in) - int64(d.out))
+		}},
+		{"hpc015_device_last_upload_timestamp_seconds", "gauge", "Time of last cache request.", func(d *deviceMetrics) string {
+			return fmt.Sprint(d.lastUpload.Unix())
+		}},
+		{"hpc015_device_transmitter_battery_percent", "gauge", "Remaining battery of infrared transmitter.", func(d *deviceMetrics) string {
+			return fmt.Sprint(d.transmitterBAT)
+		}},
+		{"hpc015_device_counter_battery_percent", "gauge", "Remaining battery of counter.", func(d *deviceMetrics) string {
+			return fmt.Sprint(d.counterBAT)
+		}},
+		{"hpc015_device_charging", "gauge", "1 if counter is being charged.", func(d *deviceMetrics) string {
+			return boolMetric(d.charge == BeingCharged)
+		}},
+		{"hpc015_device_focus_out", "gauge", "1 if transmitter and receiver are misaligned.", func(d *deviceMetrics) string {
+			return boolMetric(d.focus == FocusOut)
+		}},
+	}
+	for _, g := range gauges {
+		header(g.name, g.typ, g.help)
+		for _, serial := range serials {
+			fmt.Fprintf(cw, "%s{serial=%q} %s\n", g.name, SerialString(serial), g.value(m.devices[serial]))
+		}
+	}
+
+	header("hpc015_device_info", "gauge", "Firmware version of device.")
+	for _, serial := range serials {
+		fmt.Fprintf(cw, "hpc015_device_info{serial=%q,firmware=%q} 1\n", SerialString(serial), m.devices[serial].firmware)
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func boolMetric(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// countWriter count written bytes, and keep first error
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,55 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	c := Counter()
+	defer c.Close()
+	m := NewMetrics()
+	m.SetCounters(Counters{"lobby": c})
+	h := &Handler{Counter: c, Metrics: m}
+
+	serve(h, testSettingRequest)
+	serve(h, testCacheRequest)
+	serve(h, testCacheRequest) // resent
+	serve(h, strings.Replace(testCacheRequest, "E97E", "E97F", 1))
+	serve(h, "cmd=unknown&flag=0002&data=00000000000000000000")
+	if _, err := c.Correct(5, "manager", "recount"); err != nil {
+		t.Fatalf("Correct() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		`hpc015_requests_total{cmd="cache"} 3`,
+		`hpc015_requests_total{cmd="getsetting"} 1`,
+		`hpc015_requests_total{cmd="unknown"} 1`,
+		`hpc015_parse_failures_total{kind="cache"} 1`,
+		`hpc015_parse_failures_total{kind="cmd"} 1`,
+		`hpc015_crc_failures_total 1`,
+		`hpc015_duplicates_total 2`,
+		`hpc015_device_in_total{serial="42AE5152"} 1`,
+		`hpc015_device_out_total{serial="42AE5152"} 1`,
+		`hpc015_device_net_count{serial="42AE5152"} 0`,
+		`hpc015_occupants{zone="lobby"} 5`, // corrected, unlike net count
+		`hpc015_device_transmitter_battery_percent{serial="42AE5152"} 86`,
+		`hpc015_device_counter_battery_percent{serial="42AE5152"} 13`,
+		`hpc015_device_focus_out{serial="42AE5152"} 1`,
+		`hpc015_device_info{serial="42AE5152",firmware="1.1"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("WriteTo() missing %s, got:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DeviceEvent represent state of device changed.
+type DeviceEvent struct {
+	Device   Device
+	Previous DeviceState
+	State    DeviceState
+	Due      time.Time // when upload was expected
+}
+
+// OfflineDetector find devices, which missed their uploads.
+//
+// Device is Late when it not uploaded until `grace` after due,
+// and Offline when it not uploaded until `offline` after due.
+// Due is evaluated by UploadSchedule of configuration read back from device.
+// Device not sent getsetting yet, such as after restart of server,
+// is evaluated by Configuration, or Default() if there is no configuration for it.
+type OfflineDetector struct {
+	registry *Registry
+	grace    time.Duration
+	offline  time.Duration
+	callback func(DeviceEvent)
+
+	// Configuration returns configuration for device of `serialNumber`, same as Handler.Configuration.
+	// It is used only until configuration read back from device, fixed upload clocks are not evaluated.
+	Configuration func(serialNumber uint32) *Configuration
+
+	// Realtime is used as upload cycle of device uploading in real-time,
+	// which upload only when something counted.
+	Realtime time.Duration
+
+	states map[uint32]DeviceState
+	mux    *sync.Mutex
+}
+
+// DefaultRealtime is default of OfflineDetector.Realtime
+const DefaultRealtime = time.Hour
+
+// NewOfflineDetector create OfflineDetector, watching devices in `registry`.
+//
+// `callback` called whenever state of device changed, including back to Alive.
+func NewOfflineDetector(registry *Registry, grace, offline time.Duration, callback func(DeviceEvent)) *OfflineDetector {
+	return &OfflineDetector{
+		registry: registry,
+		grace:    grace,
+		offline:  offline,
+		callback: callback,
+		Realtime: DefaultRealtime,
+		states:   make(map[uint32]DeviceState),
+		mux:      &sync.Mutex{},
+	}
+}
+
+// Run check devices every `interval`, until `ctx` done.
+func (d *OfflineDetector) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			d.Check(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Due returns when next upload of device due.
+// If nothing scheduled, returns zero time.
+func (d *OfflineDetector) Due(device Device) time.Time {
+	last := device.LastCache
+	if device.LastGetSetting.After(last) {
+		last = device.LastGetSetting
+	}
+	if last.IsZero() {
+		return time.Time{}
+	}
+
+	conf, clocks := device.Configuration, device.UploadClocks
+	if conf == nil {
+		if d.Configuration != nil {
+			conf = d.Configuration(device.SerialNumber)
+		}
+		if conf == nil {
+			conf = Default()
+		}
+		clocks = nil
+	}
+	schedule := NewUploadSchedule(*conf, clocks, d.Realtime)
+	return schedule.Next(last)
+}
+
+// State returns current state of device
+func (d *OfflineDetector) State(serialNumber uint32) DeviceState {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return d.states[serialNumber]
+}
+
+// Check evaluate state of all devices at `now`, and call callback for changed.
+func (d *OfflineDetector) Check(now time.Time) {
+	var events []DeviceEvent
+
+	d.mux.Lock()
+	for _, device := range d.registry.Devices() {
+		due := d.Due(device)
+		if due.IsZero() {
+			continue
+		}
+
+		state := Alive
+		switch {
+		case now.After(due.Add(d.offline)):
+			state = Offline
+		case now.After(due.Add(d.grace)):
+			state = Late
+		}
+
+		previous := d.states[device.SerialNumber]
+		if state == previous {
+			continue
+		}
+		d.states[device.SerialNumber] = state
+
+		debugf("- device %s: %v -> %v (due %s)\n", SerialString(device.SerialNumber), previous, state, due.Format("2006-01-02 15:04:05"))
+		events = append(events, DeviceEvent{
+			Device:   device,
+			Previous: previous,
+			State:    state,
+			Due:      due,
+		})
+	}
+	d.mux.Unlock()
+
+	if d.callback != nil {
+		for _, e := range events {
+			d.callback(e)
+		}
+	}
+}
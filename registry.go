@@ -0,0 +1,180 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Device is last known status of a device.
+//
+// In JSON, serial number written by SerialString, same as query of Registry.
+type Device struct {
+	SerialNumber   uint32         `json:"serial"`
+	Firmware       string         `json:"firmware"`
+	MacAddress1    string         `json:"mac_address1"`
+	MacAddress2    string         `json:"mac_address2"`
+	MacAddress3    string         `json:"mac_address3"`
+	RemoteAddr     string         `json:"remote_addr"`
+	LastGetSetting time.Time      `json:"last_getsetting"`
+	LastCache      time.Time      `json:"last_cache"`
+	TransmitterBAT byte           `json:"transmitter_bat"`
+	CounterBAT     byte           `json:"counter_bat"`
+	Charge         Charge         `json:"charge"`
+	Focus          Focus          `json:"focus"`
+	Configuration  *Configuration `json:"configuration"` // read back from last getsetting
+	UploadClocks   []time.Time    `json:"upload_clocks"` // enabled fixed upload clocks, read back from last getsetting
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Device) MarshalJSON() ([]byte, error) {
+	type device Device
+	return json.Marshal(struct {
+		device
+		SerialNumber string `json:"serial"`
+	}{device(d), SerialString(d.SerialNumber)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Device) UnmarshalJSON(b []byte) error {
+	type device Device
+	v := struct {
+		*device
+		SerialNumber string `json:"serial"`
+	}{device: (*device)(d)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	serialNumber, err := strconv.ParseUint(v.SerialNumber, 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid serial: %s", err.Error())
+	}
+	d.SerialNumber = uint32(serialNumber)
+	return nil
+}
+
+// Registry remember devices, and their last known status.
+//
+// Give it to Handler.Registry, and register it on path to query devices by JSON.
+// Observe methods of nil Registry do nothing.
+type Registry struct {
+	devices map[uint32]*Device
+	mux     *sync.RWMutex
+}
+
+// NewRegistry create empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		devices: make(map[uint32]*Device),
+		mux:     &sync.RWMutex{},
+	}
+}
+
+// device returns device of `serialNumber`, create if not exist. Caller must hold lock.
+func (r *Registry) device(serialNumber uint32) *Device {
+	d, ok := r.devices[serialNumber]
+	if !ok {
+		d = &Device{SerialNumber: serialNumber}
+		r.devices[serialNumber] = d
+	}
+	return d
+}
+
+// ObserveSetting record getsetting request from `remoteAddr`.
+func (r *Registry) ObserveSetting(request *GetSettingRequest, remoteAddr string, received time.Time) {
+	if r == nil {
+		return
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	d := r.device(request.Serial())
+	d.MacAddress1 = fmt.Sprintf("%X", request.MacAddress1)
+	d.MacAddress2 = fmt.Sprintf("%X", request.MacAddress2)
+	d.MacAddress3 = fmt.Sprintf("%X", request.MacAddress3)
+	d.RemoteAddr = remoteAddr
+	d.LastGetSetting = received
+	d.Configuration = request.Configuration()
+	d.UploadClocks = request.UploadClocks()
+}
+
+// ObserveCache record status of cache request from `remoteAddr`.
+func (r *Registry) ObserveCache(status *DeviceStatus, remoteAddr string, received time.Time) {
+	if r == nil {
+		return
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	d := r.device(status.SerialNumber)
+	d.Firmware = status.Firmware()
+	d.RemoteAddr = remoteAddr
+	d.LastCache = received
+	d.TransmitterBAT = status.TransmitterBAT
+	d.CounterBAT = status.CounterBAT
+	d.Charge = status.Charge
+	d.Focus = status.Focus
+}
+
+// Device returns copy of device.
+// If device never seen, returns false.
+func (r *Registry) Device(serialNumber uint32) (Device, bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	d, ok := r.devices[serialNumber]
+	if !ok {
+		return Device{}, false
+	}
+	return *d, true
+}
+
+// Devices returns copy of all devices, ordered by serial number.
+func (r *Registry) Devices() []Device {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	devices := make([]Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		devices = append(devices, *d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].SerialNumber < devices[j].SerialNumber
+	})
+	return devices
+}
+
+// ServeHTTP write devices as JSON.
+//
+// With query `?serial=42AE5152`, write only that device, or 404 if not found.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var v interface{} = r.Devices()
+
+	if s := req.URL.Query().Get("serial"); s != "" {
+		serialNumber, err := strconv.ParseUint(s, 16, 32)
+		if err != nil {
+			http.Error(w, "invalid serial: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, ok := r.Device(uint32(serialNumber))
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		v = d
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		debugf("! failed to write devices: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,75 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	h := &Handler{Registry: r}
+
+	serve(h, testSettingRequest)
+	serve(h, testCacheRequest)
+
+	setting, ok := r.Device(0x0D3BB382)
+	if !ok {
+		t.Fatalf("Device() of getsetting not found")
+	}
+	if setting.MacAddress1 != "085DDD5A75CBDC" || setting.LastGetSetting.IsZero() || setting.Configuration == nil {
+		t.Errorf("Device() = %+v, want readback of getsetting", setting)
+	}
+	if setting.Configuration.DisplayType != Bilateral || setting.Configuration.CloseClock.Hour() != 23 {
+		t.Errorf("Configuration = %+v, want Bilateral, closed at 23", setting.Configuration)
+	}
+
+	cache, ok := r.Device(0x42AE5152)
+	if !ok {
+		t.Fatalf("Device() of cache not found")
+	}
+	if cache.Firmware != "1.1" || cache.TransmitterBAT != 86 || cache.CounterBAT != 13 || cache.Focus != FocusOut || cache.LastCache.IsZero() {
+		t.Errorf("Device() = %+v, want status of cache", cache)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/devices?serial=42AE5152", nil))
+	var got Device
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.SerialNumber != 0x42AE5152 || got.Firmware != "1.1" {
+		t.Errorf("ServeHTTP() = %+v, want device 42AE5152", got)
+	}
+
+	// serial of list can be given to query
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/devices", nil))
+	var list []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(list) != 2 || list[0]["serial"] != "0D3BB382" || list[1]["serial"] != "42AE5152" {
+		t.Fatalf("ServeHTTP() = %v, want serials in hex", list)
+	}
+	for _, d := range list {
+		serial := d["serial"].(string)
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/devices?serial="+serial, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+		if SerialString(got.SerialNumber) != serial {
+			t.Errorf("ServeHTTP() of %s = %s, want same device", serial, SerialString(got.SerialNumber))
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/devices?serial=00000001", nil))
+	if rec.Code != 404 {
+		t.Errorf("ServeHTTP() of unknown device = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,119 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxArchive is number of DailyTotal, kept by counter
+const maxArchive = 366
+
+// DailyTotal is in/out of a day, archived when counter reset.
+type DailyTotal struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	In        int       `json:"in"`
+	Out       int       `json:"out"`
+	Occupants int       `json:"occupants"` // occupants when reset
+}
+
+// SetReset make counter reset occupancy every day,
+// at OpenClock or CloseClock of `conf` depend on `mode`.
+//
+// When reset, in/out of the day archived, see DailyTotals.
+// If reset time passed while server was down, counter reset on next check.
+func (c *counter) SetReset(mode ResetMode, conf Configuration) {
+	c.mux.Lock()
+	c.resetMode = mode
+	switch mode {
+	case ResetAtOpen:
+		c.resetClock = conf.OpenClock
+	case ResetAtClose:
+		c.resetClock = conf.CloseClock
+	}
+	if c.lastReset.IsZero() {
+		c.lastReset = time.Now()
+	}
+	c.mux.Unlock()
+
+	c.checkReset(time.Now())
+}
+
+// NextReset returns time of next reset.
+// If reset not scheduled, returns zero time.
+func (c *counter) NextReset() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.resetMode == NoReset {
+		return time.Time{}
+	}
+	return c.prevReset(time.Now()).AddDate(0, 0, 1)
+}
+
+// Reset archive in/out, then zero them and correction now.
+func (c *counter) Reset() {
+	c.mux.Lock()
+	defer c.unlock()
+
+	c.reset(time.Now())
+}
+
+// DailyTotals returns archived totals, oldest first.
+func (c *counter) DailyTotals() []DailyTotal {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return append([]DailyTotal(nil), c.archive...)
+}
+
+// prevReset returns last scheduled reset time, not after `now`
+func (c *counter) prevReset(now time.Time) time.Time {
+	y, m, d := now.Date()
+	t := time.Date(y, m, d, c.resetClock.Hour(), c.resetClock.Minute(), 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// checkReset reset counter, if scheduled reset time passed since last reset
+func (c *counter) checkReset(now time.Time) {
+	c.mux.Lock()
+	defer c.unlock()
+
+	if c.resetMode == NoReset {
+		return
+	}
+	if c.lastReset.Before(c.prevReset(now)) {
+		c.reset(now)
+	}
+}
+
+// reset archive and zero counts, caller must hold lock
+func (c *counter) reset(now time.Time) {
+	total := DailyTotal{
+		Start:     c.lastReset,
+		End:       now,
+		In:        c.in,
+		Out:       c.out,
+		Occupants: c.occupants(),
+	}
+	c.archive = append(c.archive, total)
+	if len(c.archive) > maxArchive {
+		c.archive = c.archive[len(c.archive)-maxArchive:]
+	}
+
+	if EnableDebugMessage {
+		fmt.Fprintf(DebugOutput, "- reset: {in: %d, out: %d, current: %d}\n", total.In, total.Out, total.Occupants)
+	}
+
+	c.in = 0
+	c.out = 0
+	c.offset = 0
+	c.lastReset = now
+	c.changed(now, CauseReset, 0, 0)
+}
@@ -0,0 +1,96 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import "time"
+
+// UploadSchedule is when device expected to upload.
+//
+// Device upload every Cycle and at fixed Clocks, within business hours only.
+type UploadSchedule struct {
+	Cycle      time.Duration // 0 means no cycle
+	Clocks     []time.Time   // fixed upload clocks, hour and minute only
+	OpenClock  time.Time
+	CloseClock time.Time
+}
+
+// NewUploadSchedule makes schedule of device configured with `conf`,
+// and fixed upload `clocks`(see GetSettingRequest.UploadClocks).
+//
+// Device uploading in real-time(UploadCycle 0) upload only when something counted,
+// so `realtime` is used as its cycle.
+func NewUploadSchedule(conf Configuration, clocks []time.Time, realtime time.Duration) UploadSchedule {
+	cycle := time.Duration(conf.UploadCycle) * time.Minute
+	if cycle == 0 {
+		cycle = realtime
+	}
+	return UploadSchedule{
+		Cycle:      cycle,
+		Clocks:     clocks,
+		OpenClock:  conf.OpenClock,
+		CloseClock: conf.CloseClock,
+	}
+}
+
+// Next returns when next upload due, after device uploaded at `last`.
+// If nothing scheduled, returns zero time.
+func (s UploadSchedule) Next(last time.Time) time.Time {
+	var next time.Time
+
+	if s.Cycle > 0 {
+		t := last.Add(s.Cycle)
+		if !s.inBusinessHours(t) {
+			// device resume uploading after open
+			t = s.nextOpen(t).Add(s.Cycle)
+		}
+		next = t
+	}
+
+	for _, clock := range s.Clocks {
+		t := clockAfter(last, clock)
+		if !s.inBusinessHours(t) {
+			continue
+		}
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// inBusinessHours returns whether clock of `t` is within business hours.
+// When CloseClock is before OpenClock, business hours pass midnight.
+func (s UploadSchedule) inBusinessHours(t time.Time) bool {
+	open := minuteOfDay(s.OpenClock)
+	close := minuteOfDay(s.CloseClock)
+	now := minuteOfDay(t)
+
+	if open == close {
+		return true
+	}
+	if open < close {
+		return open <= now && now < close
+	}
+	return now >= open || now < close
+}
+
+// nextOpen returns first open time after `t`
+func (s UploadSchedule) nextOpen(t time.Time) time.Time {
+	return clockAfter(t, s.OpenClock)
+}
+
+// clockAfter returns first time after `t`, whose hour and minute are same with `clock`
+func clockAfter(t time.Time, clock time.Time) time.Time {
+	y, m, d := t.Date()
+	next := time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, t.Location())
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
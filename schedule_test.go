@@ -0,0 +1,128 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUploadScheduleNext(t *testing.T) {
+	clock := func(hour, minute int) time.Time {
+		return time.Date(1, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2021, 5, day, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		schedule UploadSchedule
+		last     time.Time
+		want     time.Time
+	}{
+		{
+			name:     "cycle",
+			schedule: UploadSchedule{Cycle: 30 * time.Minute, OpenClock: clock(9, 0), CloseClock: clock(18, 0)},
+			last:     at(13, 10, 0),
+			want:     at(13, 10, 30),
+		},
+		{
+			name:     "cycle after close",
+			schedule: UploadSchedule{Cycle: 30 * time.Minute, OpenClock: clock(9, 0), CloseClock: clock(18, 0)},
+			last:     at(13, 17, 45),
+			want:     at(14, 9, 30),
+		},
+		{
+			name:     "fixed clock before cycle",
+			schedule: UploadSchedule{Cycle: 2 * time.Hour, Clocks: []time.Time{clock(12, 0)}, OpenClock: clock(9, 0), CloseClock: clock(18, 0)},
+			last:     at(13, 11, 0),
+			want:     at(13, 12, 0),
+		},
+		{
+			name:     "fixed clock only",
+			schedule: UploadSchedule{Clocks: []time.Time{clock(12, 0)}, OpenClock: clock(9, 0), CloseClock: clock(18, 0)},
+			last:     at(13, 12, 0),
+			want:     at(14, 12, 0),
+		},
+		{
+			name:     "business hours pass midnight",
+			schedule: UploadSchedule{Cycle: time.Hour, OpenClock: clock(20, 0), CloseClock: clock(2, 0)},
+			last:     at(13, 23, 30),
+			want:     at(14, 0, 30),
+		},
+		{
+			name:     "nothing scheduled",
+			schedule: UploadSchedule{OpenClock: clock(9, 0), CloseClock: clock(18, 0)},
+			last:     at(13, 10, 0),
+			want:     time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Next(tt.last); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOfflineDetector(t *testing.T) {
+	r := NewRegistry()
+	serve(&Handler{Registry: r}, testSettingRequest)
+
+	device, _ := r.Device(0x0D3BB382)
+
+	var events []DeviceEvent
+	d := NewOfflineDetector(r, 5*time.Minute, time.Hour, func(e DeviceEvent) {
+		events = append(events, e)
+	})
+	due := d.Due(device)
+	if !due.After(device.LastGetSetting) {
+		t.Fatalf("Due() = %v, want after %v", due, device.LastGetSetting)
+	}
+
+	d.Check(due.Add(time.Minute))
+	d.Check(due.Add(10 * time.Minute))
+	d.Check(due.Add(2 * time.Hour))
+
+	if len(events) != 2 || events[0].State != Late || events[1].State != Offline {
+		t.Errorf("events = %v, want Late, Offline", events)
+	}
+	if got := d.State(0x0D3BB382); got != Offline {
+		t.Errorf("State() = %v, want %v", got, Offline)
+	}
+}
+
+func TestOfflineDetectorNotConfigured(t *testing.T) {
+	r := NewRegistry()
+	// after restart, device sent only cache
+	serve(&Handler{Registry: r}, testCacheRequest)
+	device, _ := r.Device(0x42AE5152)
+
+	var events []DeviceEvent
+	d := NewOfflineDetector(r, 5*time.Minute, time.Hour, func(e DeviceEvent) {
+		events = append(events, e)
+	})
+
+	// Default() upload in real-time
+	if got, want := d.Due(device), NewUploadSchedule(*Default(), nil, DefaultRealtime).Next(device.LastCache); got.IsZero() || !got.Equal(want) {
+		t.Errorf("Due() = %v, want %v", got, want)
+	}
+
+	conf := Default()
+	conf.UploadCycle = 10
+	d.Configuration = func(serialNumber uint32) *Configuration {
+		return conf
+	}
+	due := d.Due(device)
+	if want := NewUploadSchedule(*conf, nil, DefaultRealtime).Next(device.LastCache); !due.Equal(want) || due.Sub(device.LastCache) > DefaultRealtime {
+		t.Errorf("Due() = %v, want %v", due, want)
+	}
+
+	d.Check(due.Add(2 * time.Hour))
+	if len(events) != 1 || events[0].State != Offline {
+		t.Errorf("events = %v, want Offline", events)
+	}
+}
@@ -5,11 +5,12 @@
 package hpc015
 
 import (
-	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -17,8 +18,14 @@ import (
 
 var (
 	EnableDebugMessage = true
+
+	// DebugOutput is where debug messages written, when EnableDebugMessage is set.
+	DebugOutput io.Writer = os.Stdout
 )
 
+// ErrInvalidCRC is returned(wrapped) when crc of data is incorrect.
+var ErrInvalidCRC = errors.New("incorrect crc")
+
 // RequestSchema basic form of request, it just hold bunch of raw data.
 //
 // Returned value is still not useful,
@@ -38,35 +45,35 @@ type RequestSchema struct {
 }
 
 // NewRequestSchema makes RequestSchema from raw request string
+//
+// It scan request once, and hex of every data decoded into one buffer,
+// so Data share its underlying array.
 func NewRequestSchema(reqestString string) (*RequestSchema, error) {
 	if len(reqestString) < 30 {
 		return nil, errors.New("length of request must be longer than 30")
 	}
 
-	fields := strings.Split(reqestString, "&")
-
-	fieldsTable := make(map[string]string, 0)
-	for _, v := range fields {
-		field := strings.Split(v, "=")
-		fieldsTable[field[0]] = field[1]
-	}
-
 	request := &RequestSchema{
 		Data: make([][]byte, 0, 1),
 	}
 
+	// decoded data never longer than half of request
+	buf := make([]byte, 0, len(reqestString)/2)
+
 	// parse message
-	for _, field := range fields {
-		var k, v string
+	for rest := reqestString; rest != ""; {
+		field := rest
+		if i := strings.IndexByte(rest, '&'); i >= 0 {
+			field, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = ""
+		}
 
-		{
-			s := strings.Split(field, "=")
-			if len(s) != 2 {
-				continue
-			}
-			k = s[0]
-			v = s[1]
+		i := strings.IndexByte(field, '=')
+		if i < 0 || strings.IndexByte(field[i+1:], '=') >= 0 {
+			continue
 		}
+		k, v := field[:i], field[i+1:]
 
 		switch k {
 		case "cmd":
@@ -76,19 +83,19 @@ func NewRequestSchema(reqestString string) (*RequestSchema, error) {
 			request.Status = v
 
 		case "flag":
-			b, err := hex.DecodeString(v)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode flag: %s", err.Error())
+			flag, err := strconv.ParseUint(v, 16, 16)
+			if err != nil || len(v) != 4 {
+				return nil, fmt.Errorf("failed to decode flag: %q is not 2 byte hex", v)
 			}
-			flag := binary.BigEndian.Uint16(b)
-			request.Flag = flag
+			request.Flag = uint16(flag)
 
 		case "data":
-			data, err := hex.DecodeString(v)
-			if err != nil {
+			start := len(buf)
+			buf = buf[:start+hex.DecodedLen(len(v))]
+			if err := decodeHexString(buf[start:], v); err != nil {
 				return nil, fmt.Errorf("failed to decode data: %s", err.Error())
 			}
-			request.Data = append(request.Data, data)
+			request.Data = append(request.Data, buf[start:len(buf):len(buf)])
 
 		case "count":
 			count, err := strconv.ParseUint(v, 16, 16)
@@ -184,56 +191,38 @@ type GetSettingRequest struct {
 //   - Length of [data] must be 53
 //   - This function vaild CRC16
 func NewSettingRequest(data []byte) (*GetSettingRequest, error) {
-	if len(data) != 53 {
-		return nil, fmt.Errorf("length must be 53 byte, but came %d byte", len(data))
-	}
-
-	crc, err := calcCrc16(data[:51])
-	if err != nil {
-		return nil, errors.New("failed to verify crc:" + err.Error())
+	request := new(GetSettingRequest)
+	if err := request.decode(data); err != nil {
+		return nil, err
 	}
+	return request, nil
+}
 
-	incomeCrc := binary.BigEndian.Uint16(data[51:53])
+// Serial returns serial number, in same byte order as DeviceStatus.SerialNumber
+func (request GetSettingRequest) Serial() uint32 {
+	return binary.BigEndian.Uint32(request.SerialNumber)
+}
 
-	if crc != incomeCrc {
-		return nil, errors.New("failed to verify crc: incorrect crc")
-	}
+// Configuration returns configuration of device, read back from request
+func (request GetSettingRequest) Configuration() *Configuration {
+	return request.Response(0).GetConfiguration()
+}
 
-	getSetting := &GetSettingRequest{
-		SerialNumber:    data[0:4],
-		TimeVerifyMode:  TimeVerifyMode(data[4]),
-		Speed:           Speed(data[5]),
-		RecordingCycle:  data[6],
-		UploadCycle:     data[7],
-		FixedTimeUpload: data[8],
-		UploadHour1:     data[9],
-		UploadMinute1:   data[10],
-		UploadHour2:     data[11],
-		UploadMinute2:   data[12],
-		UploadHour3:     data[13],
-		UploadMinute3:   data[14],
-		UploadHour4:     data[15],
-		UploadMinute4:   data[16],
-		NetworkType:     NetworkType(data[17]),
-		DisplayType:     DisplayType(data[18]),
-		MacAddress1:     data[19:26],
-		MacAddress2:     data[26:33],
-		MacAddress3:     data[33:40],
-		Year:            data[40],
-		Month:           data[41],
-		Day:             data[42],
-		Hour:            data[43],
-		Minute:          data[44],
-		Second:          data[45],
-		Week:            data[46],
-		OpenHour:        data[47],
-		OpenMinute:      data[48],
-		CloseHour:       data[49],
-		CloseMinute:     data[50],
-		Crc16:           crc,
+// UploadClocks returns enabled fixed upload clocks, hour and minute only.
+//
+// Manual does not describe FixedTimeUpload,
+// it treated as bit mask, bit 0 enables UploadHour1/UploadMinute1, and so on.
+func (request GetSettingRequest) UploadClocks() []time.Time {
+	hours := []byte{request.UploadHour1, request.UploadHour2, request.UploadHour3, request.UploadHour4}
+	minutes := []byte{request.UploadMinute1, request.UploadMinute2, request.UploadMinute3, request.UploadMinute4}
+
+	var clocks []time.Time
+	for i := range hours {
+		if request.FixedTimeUpload&(1<<uint(i)) != 0 {
+			clocks = append(clocks, time.Date(1, 1, 1, int(hours[i]), int(minutes[i]), 0, 0, time.Local))
+		}
 	}
-
-	return getSetting, nil
+	return clocks
 }
 
 // Response generate response about request
@@ -384,7 +373,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if original.TimeVerifyMode != cog.TimeVerifyMode {
 		if EnableDebugMessage {
-			fmt.Printf("- configuration changed: TimeVerifyMode: %v -> %v\n", response.TimeVerifyMode, cog.TimeVerifyMode)
+			fmt.Fprintf(DebugOutput, "- configuration changed: TimeVerifyMode: %v -> %v\n", response.TimeVerifyMode, cog.TimeVerifyMode)
 		}
 		response.TimeVerifyMode = cog.TimeVerifyMode
 		response.RespondingType = NewParameterValue
@@ -392,7 +381,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if original.Speed != cog.Speed {
 		if EnableDebugMessage {
-			fmt.Printf("- configuration changed: Speed: %v -> %v\n", response.Speed, cog.Speed)
+			fmt.Fprintf(DebugOutput, "- configuration changed: Speed: %v -> %v\n", response.Speed, cog.Speed)
 		}
 		response.Speed = cog.Speed
 		response.RespondingType = NewParameterValue
@@ -400,7 +389,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if original.RecordingCycle != cog.RecordingCycle {
 		if EnableDebugMessage {
-			fmt.Printf("- configuration changed: RecordingCycle: %v -> %v\n", response.RecordingCycle, cog.RecordingCycle)
+			fmt.Fprintf(DebugOutput, "- configuration changed: RecordingCycle: %v -> %v\n", response.RecordingCycle, cog.RecordingCycle)
 		}
 		response.RecordingCycle = cog.RecordingCycle
 		response.RespondingType = NewParameterValue
@@ -408,7 +397,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if original.UploadCycle != cog.UploadCycle {
 		if EnableDebugMessage {
-			fmt.Printf("- configuration changed: UploadCycle: %v -> %v\n", response.UploadCycle, cog.UploadCycle)
+			fmt.Fprintf(DebugOutput, "- configuration changed: UploadCycle: %v -> %v\n", response.UploadCycle, cog.UploadCycle)
 		}
 		response.UploadCycle = cog.UploadCycle
 		response.RespondingType = NewParameterValue
@@ -416,7 +405,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if original.EnableFixedTimeUpload != cog.EnableFixedTimeUpload {
 		if EnableDebugMessage {
-			fmt.Printf("- configuration changed: EnableFixedTimeUpload: %v -> %v\n", response.FixedTimeUpload, cog.EnableFixedTimeUpload)
+			fmt.Fprintf(DebugOutput, "- configuration changed: EnableFixedTimeUpload: %v -> %v\n", response.FixedTimeUpload, cog.EnableFixedTimeUpload)
 		}
 		response.FixedTimeUpload = cog.EnableFixedTimeUpload
 		response.RespondingType = NewParameterValue
@@ -431,7 +420,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if original.NetworkType != cog.NetworkType {
 		if EnableDebugMessage {
-			fmt.Printf("- configuration changed: NetworkType: %v -> %v\n", response.NetworkType, cog.NetworkType)
+			fmt.Fprintf(DebugOutput, "- configuration changed: NetworkType: %v -> %v\n", response.NetworkType, cog.NetworkType)
 		}
 		response.NetworkType = cog.NetworkType
 		response.RespondingType = NewParameterValue
@@ -439,7 +428,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if original.DisplayType != cog.DisplayType {
 		if EnableDebugMessage {
-			fmt.Printf("- configuration changed: DisplayType: %v -> %v\n", response.DisplayType, cog.DisplayType)
+			fmt.Fprintf(DebugOutput, "- configuration changed: DisplayType: %v -> %v\n", response.DisplayType, cog.DisplayType)
 		}
 		response.DisplayType = cog.DisplayType
 		response.RespondingType = NewParameterValue
@@ -447,7 +436,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if !equalTime(original.SystemTime, cog.SystemTime) {
 		if EnableDebugMessage {
-			fmt.Printf(
+			fmt.Fprintf(DebugOutput,
 				"- configuration changed: SystemTime: %v-%v-%v %v:%v:%v -> %v-%v-%v %v:%v:%v\n",
 				response.Year,
 				response.Month,
@@ -474,7 +463,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if !equalClockOmitSec(original.OpenClock, cog.OpenClock) {
 		if EnableDebugMessage {
-			fmt.Printf(
+			fmt.Fprintf(DebugOutput,
 				"- configuration changed: OpenClock: %v:%v -> %v:%v\n",
 				response.OpenHour,
 				response.OpenMinute,
@@ -489,7 +478,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 
 	if !equalClockOmitSec(original.CloseClock, cog.CloseClock) {
 		if EnableDebugMessage {
-			fmt.Printf(
+			fmt.Fprintf(DebugOutput,
 				"- configuration changed: CloseClock: %v:%v -> %v:%v\n",
 				response.CloseHour,
 				response.CloseMinute,
@@ -511,54 +500,7 @@ func (response *GetSettingResponse) SetConfiguration(cog Configuration) (bool, e
 // For example:
 //   resp := fmt.Sprintf("result=%X", bin)
 func (response GetSettingResponse) Binary() ([]byte, error) {
-	buf := bytes.NewBuffer(make([]byte, 0, 58))
-	binary.Write(buf, binary.BigEndian, response.RespondingType)
-	binary.Write(buf, binary.BigEndian, response.Flag)
-	binary.Write(buf, binary.BigEndian, response.SerialNumber)
-	binary.Write(buf, binary.BigEndian, response.TimeVerifyMode)
-	binary.Write(buf, binary.BigEndian, response.Speed)
-	binary.Write(buf, binary.BigEndian, response.RecordingCycle)
-	binary.Write(buf, binary.BigEndian, response.UploadCycle)
-	binary.Write(buf, binary.BigEndian, response.FixedTimeUpload)
-	binary.Write(buf, binary.BigEndian, response.UploadHour1)
-	binary.Write(buf, binary.BigEndian, response.UploadMinute1)
-	binary.Write(buf, binary.BigEndian, response.UploadHour2)
-	binary.Write(buf, binary.BigEndian, response.UploadMinute2)
-	binary.Write(buf, binary.BigEndian, response.UploadHour3)
-	binary.Write(buf, binary.BigEndian, response.UploadMinute3)
-	binary.Write(buf, binary.BigEndian, response.UploadHour4)
-	binary.Write(buf, binary.BigEndian, response.UploadMinute4)
-	binary.Write(buf, binary.BigEndian, response.NetworkType)
-	binary.Write(buf, binary.BigEndian, response.DisplayType)
-	binary.Write(buf, binary.BigEndian, response.MacAddress1)
-	binary.Write(buf, binary.BigEndian, response.MacAddress2)
-	binary.Write(buf, binary.BigEndian, response.MacAddress3)
-	binary.Write(buf, binary.BigEndian, response.Year)
-	binary.Write(buf, binary.BigEndian, response.Month)
-	binary.Write(buf, binary.BigEndian, response.Day)
-	binary.Write(buf, binary.BigEndian, response.Hour)
-	binary.Write(buf, binary.BigEndian, response.Minute)
-	binary.Write(buf, binary.BigEndian, response.Second)
-	binary.Write(buf, binary.BigEndian, response.Week)
-	binary.Write(buf, binary.BigEndian, response.OpenHour)
-	binary.Write(buf, binary.BigEndian, response.OpenMinute)
-	binary.Write(buf, binary.BigEndian, response.CloseHour)
-	binary.Write(buf, binary.BigEndian, response.CloseMinute)
-	binary.Write(buf, binary.BigEndian, response.Reserved1)
-	binary.Write(buf, binary.BigEndian, response.Reserved2)
-
-	// eval crc
-	crc, err := calcCrc16(buf.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	binary.Write(buf, binary.BigEndian, crc)
-
-	if buf.Len() != 58 {
-		return nil, errors.New("response length must be 58")
-	}
-
-	return buf.Bytes(), err
+	return response.AppendBinary(nil)
 }
 
 // DeviceStatus represent datus of device
@@ -585,94 +527,19 @@ type DeviceStatus struct {
 	Crc16          uint16 // BigEndian
 }
 
-func NewDeviceStatus(data string) (*DeviceStatus, error) {
-	if len(data) != 28 {
-		return nil, fmt.Errorf("failed to parse GetSettingRequest: length must be 53 byte, but came %d byte", len(data))
-	}
-
-	var status = new(DeviceStatus)
-
-	data, version, err := readU16(data)
-	if err != nil {
-		return nil, err
-	}
-	data, serialNumber, err := readU32(data)
-	if err != nil {
-		return nil, err
-	}
-	data, focus, err := readU8(data)
-	if err != nil {
-		return nil, err
-	}
-	data, transmitterBattery, err := readU8(data)
-	if err != nil {
-		return nil, err
-	}
-	data, retention1, err := readU8(data)
-	if err != nil {
-		return nil, err
-	}
-	data, receiverBattery, err := readU8(data)
-	if err != nil {
-		return nil, err
-	}
-	data, charge, err := readU8(data)
-	if err != nil {
-		return nil, err
-	}
-
-	data, retention2, err := readU8(data)
-	if err != nil {
-		return nil, err
-	}
+// Firmware returns version of firmware, such as `1.1`
+func (status DeviceStatus) Firmware() string {
+	return fmt.Sprintf("%d.%d", status.Version>>8, status.Version&0xFF)
+}
 
-	data, crc, err := readU16(data)
-	if err != nil {
+func NewDeviceStatus(data string) (*DeviceStatus, error) {
+	status := new(DeviceStatus)
+	if err := status.decodeHex(data); err != nil {
 		return nil, err
 	}
-
-	status.Version = version
-	status.SerialNumber = serialNumber
-	status.Focus = Focus(focus)
-	status.TransmitterBAT = transmitterBattery
-	status.Reserved_1 = retention1
-	status.CounterBAT = receiverBattery
-	status.Charge = Charge(charge)
-	status.Reserved_2 = retention2
-	status.Crc16 = crc
-
 	return status, nil
 }
 
-// calcCrc16 verifies all byte calculation before crc fields(excluding “result=”)
-//   - length of `data` must not logner than 78.
-//   - 1 byte high 8, 1 byte low 8
-//   - result of this function always treated as BigEndian
-func calcCrc16(data []byte) (uint16, error) {
-	var crc uint16 = 0xFFFF
-
-	if len(data) > 78 {
-		return 0, errors.New("length of data must less than 78")
-	}
-
-	for j := 0; j < len(data); j++ {
-		crc ^= uint16(data[j])
-
-		for i := 0; i < 8; i++ {
-			if (crc & 0x01) == 1 {
-				crc >>= 1
-				crc ^= 0xA001
-			} else {
-				crc >>= 1
-			}
-		}
-	}
-
-	crc = (crc % 0x100) | ((crc / 0x100) << 8)
-
-	return crc, nil
-}
-
 type CacheData struct {
 	Year    byte
 	Month   byte
@@ -687,31 +554,16 @@ type CacheData struct {
 }
 
 func NewCacheData(data []byte) (*CacheData, error) {
-	if len(data) != 17 {
-		return nil, fmt.Errorf("failed to parse CacheData: length must be 17 byte, but came %d byte", len(data))
-	}
-
-	crc, err := calcCrc16(data[:15])
-	if err != nil {
-		return nil, errors.New("failed to verify crc:" + err.Error())
-	}
-
-	if crc != binary.BigEndian.Uint16(data[15:17]) {
-		return nil, errors.New("failed to parse CacheData: incorrect crc")
+	cacheData := new(CacheData)
+	if err := cacheData.decode(data); err != nil {
+		return nil, err
 	}
+	return cacheData, nil
+}
 
-	return &CacheData{
-		data[0],
-		data[1],
-		data[2],
-		data[3],
-		data[4],
-		data[5],
-		Focus(data[6]),
-		binary.LittleEndian.Uint32(data[7:11]),
-		binary.LittleEndian.Uint32(data[11:15]),
-		crc,
-	}, nil
+// Time returns time of event, in local time zone.
+func (data CacheData) Time() time.Time {
+	return time.Date(int(data.Year)+2000, time.Month(data.Month), int(data.Day), int(data.Hour), int(data.Minute), int(data.Secound), 0, time.Local)
 }
 
 // There are more fields, such as Tend and temp,
@@ -783,28 +635,5 @@ type CacheResponse struct {
 }
 
 func (response *CacheResponse) Binary() ([]byte, error) {
-	buf := bytes.NewBuffer(make([]byte, 0, 58))
-	binary.Write(buf, binary.BigEndian, response.AnswerType)
-	binary.Write(buf, binary.BigEndian, response.Flag)
-	binary.Write(buf, binary.BigEndian, response.TimeVerifyMode)
-	binary.Write(buf, binary.BigEndian, response.Year)
-	binary.Write(buf, binary.BigEndian, response.Month)
-	binary.Write(buf, binary.BigEndian, response.Day)
-	binary.Write(buf, binary.BigEndian, response.Hour)
-	binary.Write(buf, binary.BigEndian, response.Minute)
-	binary.Write(buf, binary.BigEndian, response.Second)
-	binary.Write(buf, binary.BigEndian, response.Week)
-	binary.Write(buf, binary.BigEndian, response.OpenHour)
-	binary.Write(buf, binary.BigEndian, response.OpenMinute)
-	binary.Write(buf, binary.BigEndian, response.CloseHour)
-	binary.Write(buf, binary.BigEndian, response.CloseMinute)
-
-	// eval crc
-	crc, err := calcCrc16(buf.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	binary.Write(buf, binary.BigEndian, crc)
-
-	return buf.Bytes(), err
+	return response.AppendBinary(nil)
 }
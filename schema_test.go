@@ -412,12 +412,7 @@ func TestCalcCrc16(t *testing.T) {
 	}
 
 	for _, tc := range tests {
-		res, err := calcCrc16(tc.input)
-		if err != nil {
-			t.Error(err)
-			t.FailNow()
-		}
-
+		res := Crc16(tc.input)
 		if res != tc.output {
 			t.Error("not equal")
 			t.FailNow()
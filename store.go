@@ -0,0 +1,285 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventStore store events, received from devices.
+//
+// Implement this to keep events in your own database,
+// and give it to Handler.Store.
+type EventStore interface {
+	// Append store events.
+	// Events must be persisted when it returns nil,
+	// because Handler answer OK to device right after.
+	Append(events ...Event) error
+
+	// Range returns events of device, whose EventTime is in [from, to),
+	// ordered by EventTime.
+	Range(serialNumber uint32, from, to time.Time) ([]Event, error)
+
+	// Latest returns latest event of device.
+	// If there is no event, returns false.
+	Latest(serialNumber uint32) (Event, bool, error)
+}
+
+// MemoryStore is EventStore, which keep events in memory only.
+//
+// Same event sent again by device is stored only once.
+// Use this for test, or as index of other store.
+type MemoryStore struct {
+	events map[uint32][]Event // ordered by EventTime
+	mux    *sync.RWMutex
+}
+
+// NewMemoryStore create empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events: make(map[uint32][]Event),
+		mux:    &sync.RWMutex{},
+	}
+}
+
+// Append implements EventStore
+func (s *MemoryStore) Append(events ...Event) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, e := range events {
+		s.insert(e)
+	}
+	return nil
+}
+
+// insert put event in order of EventTime, ignore duplicated event
+func (s *MemoryStore) insert(e Event) {
+	list := s.events[e.SerialNumber]
+
+	i := sort.Search(len(list), func(i int) bool {
+		return list[i].EventTime.After(e.EventTime)
+	})
+
+	// duplicated event has same EventTime, so it must be just before i
+	for j := i - 1; j >= 0 && list[j].EventTime.Equal(e.EventTime); j-- {
+		if list[j].DxIn == e.DxIn && list[j].DxOut == e.DxOut && list[j].Focus == e.Focus {
+			return
+		}
+	}
+
+	list = append(list, Event{})
+	copy(list[i+1:], list[i:])
+	list[i] = e
+	s.events[e.SerialNumber] = list
+}
+
+// Range implements EventStore
+func (s *MemoryStore) Range(serialNumber uint32, from, to time.Time) ([]Event, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	list := s.events[serialNumber]
+	begin := sort.Search(len(list), func(i int) bool {
+		return !list[i].EventTime.Before(from)
+	})
+	end := sort.Search(len(list), func(i int) bool {
+		return !list[i].EventTime.Before(to)
+	})
+	if begin >= end {
+		return nil, nil
+	}
+
+	result := make([]Event, end-begin)
+	copy(result, list[begin:end])
+	return result, nil
+}
+
+// dropBefore remove events whose EventTime is before `t`
+func (s *MemoryStore) dropBefore(t time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for serialNumber, list := range s.events {
+		i := sort.Search(len(list), func(i int) bool {
+			return !list[i].EventTime.Before(t)
+		})
+		if i == 0 {
+			continue
+		}
+		if i == len(list) {
+			delete(s.events, serialNumber)
+			continue
+		}
+		// copy, so dropped events can be collected
+		s.events[serialNumber] = append([]Event(nil), list[i:]...)
+	}
+}
+
+// Latest implements EventStore
+func (s *MemoryStore) Latest(serialNumber uint32) (Event, bool, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	list := s.events[serialNumber]
+	if len(list) == 0 {
+		return Event{}, false, nil
+	}
+	return list[len(list)-1], true, nil
+}
+
+// FileStore is EventStore, which write events to EventLog
+// and keep recent events in memory.
+//
+// Only events within retention window are kept in memory.
+// Range over older events read the log(including rotated files) from disk.
+type FileStore struct {
+	log       *EventLog
+	recent    *MemoryStore
+	retention time.Duration // 0 means keep all in memory
+
+	latest map[uint32]Event
+	since  time.Time // every event since this is in recent
+	pruned time.Time // when recent pruned last
+	mux    *sync.Mutex
+}
+
+// OpenFileStore open FileStore, which keep events in log at `path`,
+// and keep all of them in memory.
+//
+// Log rotated when it become larger than `maxSize` byte, 0 means never rotate.
+func OpenFileStore(path string, maxSize int64) (*FileStore, error) {
+	return OpenFileStoreWithRetention(path, maxSize, 0)
+}
+
+// OpenFileStoreWithRetention open FileStore, which keep events in log at `path`,
+// and keep events of last `retention` in memory, 0 means keep all.
+//
+// Log rotated when it become larger than `maxSize` byte, 0 means never rotate.
+func OpenFileStoreWithRetention(path string, maxSize int64, retention time.Duration) (*FileStore, error) {
+	// open first, so incomplete line truncated before read
+	log, err := OpenEventLog(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s := &FileStore{
+		log:       log,
+		recent:    NewMemoryStore(),
+		retention: retention,
+		latest:    make(map[uint32]Event),
+		pruned:    now,
+		mux:       &sync.Mutex{},
+	}
+	if retention > 0 {
+		s.since = now.Add(-retention)
+	}
+
+	err = log.scan(func(e Event) error {
+		s.observe(e)
+		if !e.EventTime.Before(s.since) {
+			s.recent.insert(e)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// observe update latest event of device, caller must hold lock or own store
+func (s *FileStore) observe(e Event) {
+	if latest, ok := s.latest[e.SerialNumber]; !ok || !e.EventTime.Before(latest.EventTime) {
+		s.latest[e.SerialNumber] = e
+	}
+}
+
+// Append implements EventStore, events are synced to disk before return.
+func (s *FileStore) Append(events ...Event) error {
+	if err := s.log.Append(events...); err != nil {
+		return err
+	}
+	s.recent.Append(events...)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, e := range events {
+		s.observe(e)
+	}
+	s.prune(time.Now())
+	return nil
+}
+
+// prune drop events out of retention from memory, at most once a minute.
+// caller must hold lock.
+func (s *FileStore) prune(now time.Time) {
+	if s.retention == 0 || now.Sub(s.pruned) < time.Minute {
+		return
+	}
+	s.pruned = now
+	s.since = now.Add(-s.retention)
+	s.recent.dropBefore(s.since)
+}
+
+// Range implements EventStore
+//
+// If `from` is out of retention, events read from disk.
+func (s *FileStore) Range(serialNumber uint32, from, to time.Time) ([]Event, error) {
+	s.mux.Lock()
+	since := s.since
+	s.mux.Unlock()
+
+	if !from.Before(since) {
+		return s.recent.Range(serialNumber, from, to)
+	}
+
+	// same as memory, ordered and without duplicated event
+	found := NewMemoryStore()
+	err := s.log.scan(func(e Event) error {
+		if e.SerialNumber == serialNumber && !e.EventTime.Before(from) && e.EventTime.Before(to) {
+			found.insert(e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found.Range(serialNumber, from, to)
+}
+
+// ReceivedSince returns events received since `t`, in order of written.
+// It read log from disk, see counter.Replay.
+func (s *FileStore) ReceivedSince(t time.Time) ([]Event, error) {
+	var events []Event
+	err := s.log.scan(func(e Event) error {
+		if !e.Received.Before(t) {
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Latest implements EventStore
+func (s *FileStore) Latest(serialNumber uint32) (Event, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	e, ok := s.latest[serialNumber]
+	return e, ok, nil
+}
+
+// Close close log file
+func (s *FileStore) Close() error {
+	return s.log.Close()
+}
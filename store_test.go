@@ -0,0 +1,129 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testEvent(serialNumber uint32, second byte, in, out uint32) Event {
+	return NewEvent(serialNumber, &CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: second, DxIn: in, Dxout: out}, time.Now())
+}
+
+func testEventStore(t *testing.T, s EventStore) {
+	err := s.Append(
+		testEvent(1, 44, 0, 1),
+		testEvent(1, 42, 1, 0),
+		testEvent(2, 43, 1, 0),
+		testEvent(1, 42, 1, 0), // duplicated
+		testEvent(1, 50, 2, 0),
+	)
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	from := time.Date(2021, 5, 13, 13, 51, 42, 0, time.Local)
+	to := time.Date(2021, 5, 13, 13, 51, 50, 0, time.Local)
+	got, err := s.Range(1, from, to)
+	if err != nil {
+		t.Fatalf("Range() error = %v", err)
+	}
+	if len(got) != 2 || got[0].EventTime.Second() != 42 || got[1].EventTime.Second() != 44 {
+		t.Errorf("Range() = %v, want events at 42, 44", got)
+	}
+
+	latest, ok, err := s.Latest(1)
+	if err != nil || !ok {
+		t.Fatalf("Latest() = %v, %v, %v", latest, ok, err)
+	}
+	if latest.EventTime.Second() != 50 || latest.DxIn != 2 {
+		t.Errorf("Latest() = %v, want event at 50", latest)
+	}
+
+	if _, ok, _ := s.Latest(3); ok {
+		t.Errorf("Latest() of unknown device = %v, want false", ok)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testEventStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	s, err := OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	testEventStore(t, s)
+	s.Close()
+
+	// reopened store must have same events
+	s, err = OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	defer s.Close()
+
+	got, _ := s.Range(1, time.Time{}, time.Now())
+	if len(got) != 3 {
+		t.Errorf("Range() after reopen = %d events, want %d", len(got), 3)
+	}
+}
+
+func TestFileStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	s, err := OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	testEventStore(t, s)
+	s.Close()
+
+	// crashed while appending
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"serial":1,"event_ti`)
+	f.Close()
+
+	// events of 2021 are out of retention
+	s, err = OpenFileStoreWithRetention(path, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFileStoreWithRetention() error = %v", err)
+	}
+	defer s.Close()
+
+	if got, _ := s.recent.Range(1, time.Time{}, time.Now()); len(got) != 0 {
+		t.Errorf("events in memory = %d, want %d", len(got), 0)
+	}
+	if latest, ok, _ := s.Latest(1); !ok || latest.EventTime.Second() != 50 {
+		t.Errorf("Latest() = %v, %v, want event at 50", latest, ok)
+	}
+
+	// read from disk
+	got, err := s.Range(1, time.Time{}, time.Now())
+	if err != nil || len(got) != 3 {
+		t.Errorf("Range() = %d events, %v, want %d events", len(got), err, 3)
+	}
+
+	// recent event kept in memory
+	now := time.Now()
+	recent := NewEvent(1, &CacheData{Year: byte(now.Year() - 2000), Month: byte(now.Month()), Day: byte(now.Day()), Hour: byte(now.Hour()), Minute: byte(now.Minute()), DxIn: 1}, now)
+	if err := s.Append(recent); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if got, _ := s.recent.Range(1, time.Time{}, now.Add(time.Minute)); len(got) != 1 {
+		t.Errorf("events in memory = %d, want %d", len(got), 1)
+	}
+	if got, _ := s.Range(1, time.Time{}, now.Add(time.Minute)); len(got) != 4 {
+		t.Errorf("Range() = %d events, want %d", len(got), 4)
+	}
+}
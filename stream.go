@@ -0,0 +1,240 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	streamHistory   = 256              // number of events kept for reconnected client
+	streamBuffer    = 64               // number of events buffered for each client
+	streamHeartbeat = 15 * time.Second // interval of comment line, to keep connection alive
+)
+
+// streamEvent is Update of a zone, sent as data of Server-Sent Event
+type streamEvent struct {
+	ID   uint64 `json:"-"`
+	Zone string `json:"zone"`
+	Update
+}
+
+// EventStream is http.Handler, which stream Update of counters as Server-Sent Events.
+//
+// Client can choose zones by query, such as `?zone=lobby&zone=hall`, otherwise receive all.
+// New client first receive current state of each zone, as Update of CauseSnapshot.
+// Each event has id, and reconnected client with `Last-Event-ID` header
+// receive events it missed, as long as they are kept in history.
+//
+// Ids start from time of NewEventStream in nanoseconds, so they are not reused after restart.
+// `Last-Event-ID` never issued by this stream, such as of previous process,
+// is treated as new client, which receive current state.
+//
+// Slow client is disconnected, and expected to reconnect with `Last-Event-ID`.
+type EventStream struct {
+	cancel   context.CancelFunc
+	counters Counters
+
+	firstID uint64 // id of first event
+	lastID  uint64
+	history []streamEvent // oldest first
+	clients map[chan streamEvent]struct{}
+	mux     *sync.Mutex
+}
+
+// NewEventStream create EventStream, which stream updates of `counters`.
+//
+// Call Close to stop subscribing counters.
+func NewEventStream(counters Counters) *EventStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	seed := uint64(time.Now().UnixNano())
+	s := &EventStream{
+		cancel:   cancel,
+		counters: counters,
+		firstID:  seed + 1,
+		lastID:   seed,
+		clients:  make(map[chan streamEvent]struct{}),
+		mux:      &sync.Mutex{},
+	}
+	for zone, c := range counters {
+		go s.receive(zone, c.Subscribe(ctx))
+	}
+	return s
+}
+
+// Close stop subscribing counters, connected clients are disconnected.
+func (s *EventStream) Close() {
+	s.cancel()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for ch := range s.clients {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+func (s *EventStream) receive(zone string, updates <-chan Update) {
+	for update := range updates {
+		s.broadcast(zone, update)
+	}
+}
+
+// broadcast record event to history, and send it to clients
+func (s *EventStream) broadcast(zone string, update Update) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.lastID++
+	event := streamEvent{ID: s.lastID, Zone: zone, Update: update}
+
+	s.history = append(s.history, event)
+	if len(s.history) > streamHistory {
+		s.history = s.history[len(s.history)-streamHistory:]
+	}
+
+	for ch := range s.clients {
+		select {
+		case ch <- event:
+		default:
+			// too slow, disconnect
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// connect register client, and returns events after `lastID`.
+// If `lastID` is not issued by this stream, returns current state of zones instead.
+func (s *EventStream) connect(lastID uint64) (chan streamEvent, []streamEvent) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var missed []streamEvent
+	if lastID < s.firstID || lastID > s.lastID {
+		missed = s.snapshot()
+	} else {
+		for _, e := range s.history {
+			if e.ID > lastID {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	ch := make(chan streamEvent, streamBuffer)
+	s.clients[ch] = struct{}{}
+	return ch, missed
+}
+
+// snapshot returns current state of zones, with id of last event, caller must hold lock
+func (s *EventStream) snapshot() []streamEvent {
+	zones := make([]string, 0, len(s.counters))
+	for zone := range s.counters {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	events := make([]streamEvent, 0, len(zones))
+	for _, zone := range zones {
+		events = append(events, streamEvent{ID: s.lastID, Zone: zone, Update: s.counters[zone].state()})
+	}
+	return events
+}
+
+func (s *EventStream) disconnect(ch chan streamEvent) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.clients[ch]; ok {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	zones := make(map[string]bool)
+	for _, zone := range req.URL.Query()["zone"] {
+		zones[zone] = true
+	}
+
+	var lastID uint64
+	if v := req.Header.Get("Last-Event-ID"); v != "" {
+		lastID, _ = strconv.ParseUint(v, 10, 64)
+	}
+
+	ch, missed := s.connect(lastID)
+	defer s.disconnect(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	// Update published before snapshot may be broadcasted after it, skip it by Seq
+	seqs := make(map[string]uint64)
+	for _, e := range missed {
+		if e.Cause == CauseSnapshot {
+			seqs[e.Zone] = e.Seq
+		}
+	}
+
+	write := func(e streamEvent) error {
+		if len(zones) != 0 && !zones[e.Zone] {
+			return nil
+		}
+		if seq, ok := seqs[e.Zone]; ok && e.Cause != CauseSnapshot && e.Seq <= seq {
+			return nil
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: update\ndata: %s\n\n", e.ID, data)
+		return err
+	}
+
+	for _, e := range missed {
+		if err := write(e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := write(e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,147 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextEvent returns id and data of next event in stream
+func nextEvent(t *testing.T, scanner *bufio.Scanner) (string, string) {
+	var id string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "id: ") {
+			id = strings.TrimPrefix(line, "id: ")
+		} else if strings.HasPrefix(line, "data: ") {
+			return id, strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("stream ended: %v", scanner.Err())
+	return "", ""
+}
+
+func TestEventStream(t *testing.T) {
+	lobby, hall := Counter(), Counter()
+	defer lobby.Close()
+	defer hall.Close()
+
+	s := NewEventStream(Counters{"lobby": lobby, "hall": hall})
+	defer s.Close()
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	// receive events as client, to wait until they broadcasted
+	ch, _ := s.connect(0)
+	defer s.disconnect(ch)
+
+	lobby.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 1, DxIn: 1})
+	hall.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 2, DxIn: 1})
+	lobby.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 3, DxIn: 1})
+
+	// counters are subscribed concurrently, find ids of lobby
+	var first, second, last uint64
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-ch:
+			if e.Zone == "lobby" && e.Occupants == 1 {
+				first = e.ID
+			} else if e.Zone == "lobby" && e.Occupants == 2 {
+				second = e.ID
+			}
+			if e.ID > last {
+				last = e.ID
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d events broadcasted, want %d", i, 3)
+		}
+	}
+
+	get := func(lastID string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"?zone=lobby", nil)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		return resp
+	}
+
+	// reconnected client, which missed events after first one
+	resp := get(strconv.FormatUint(first, 10))
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", got)
+	}
+	id, data := nextEvent(t, bufio.NewScanner(resp.Body))
+	if want := strconv.FormatUint(second, 10); id != want {
+		t.Errorf("first event id = %s, want %s", id, want)
+	}
+	if !strings.Contains(data, `"zone":"lobby"`) || !strings.Contains(data, `"occupants":2`) {
+		t.Errorf("data = %s, want lobby with 2 occupants", data)
+	}
+
+	// new client receive current state, not history
+	resp = get("")
+	defer resp.Body.Close()
+	id, data = nextEvent(t, bufio.NewScanner(resp.Body))
+	if want := strconv.FormatUint(last, 10); id != want {
+		t.Errorf("first event id = %s, want %s", id, want)
+	}
+	if !strings.Contains(data, `"cause":"snapshot"`) || !strings.Contains(data, `"occupants":2`) {
+		t.Errorf("data = %s, want snapshot of lobby with 2 occupants", data)
+	}
+}
+
+func TestEventStreamUnknownID(t *testing.T) {
+	lobby := Counter()
+	defer lobby.Close()
+	s := NewEventStream(Counters{"lobby": lobby})
+	defer s.Close()
+
+	s.broadcast("lobby", Update{Occupants: 1})
+	s.broadcast("lobby", Update{Occupants: 2})
+
+	s.mux.Lock()
+	first := s.history[0].ID
+	s.mux.Unlock()
+
+	// issued id of previous process is not reused
+	if first <= 2 {
+		t.Errorf("first id = %d, want seeded by time", first)
+	}
+
+	tests := []struct {
+		name     string
+		lastID   uint64
+		want     int
+		snapshot bool
+	}{
+		{"new client", 0, 1, true},
+		{"issued", first, 1, false},
+		{"last", first + 1, 0, false},
+		{"previous process", 1, 1, true},
+		{"never issued", first + 100, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, missed := s.connect(tt.lastID)
+			defer s.disconnect(ch)
+			if len(missed) != tt.want {
+				t.Fatalf("connect(%d) = %d events, want %d", tt.lastID, len(missed), tt.want)
+			}
+			if len(missed) != 0 && (missed[0].Cause == CauseSnapshot) != tt.snapshot {
+				t.Errorf("connect(%d) = %v, want snapshot %v", tt.lastID, missed[0], tt.snapshot)
+			}
+		})
+	}
+}
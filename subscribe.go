@@ -0,0 +1,89 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"context"
+	"time"
+)
+
+// Cause of Update
+const (
+	CauseCount      = "count"
+	CauseSet        = "set"
+	CauseCorrection = "correction"
+	CauseReset      = "reset"
+	CauseSnapshot   = "snapshot" // current state, not changed
+)
+
+// subscriptionBuffer is number of Update, buffered for each subscriber
+const subscriptionBuffer = 16
+
+// Update represent change of counter, sent to subscribers.
+type Update struct {
+	Seq       uint64        `json:"seq"` // increased by every update of counter
+	Time      time.Time     `json:"time"`
+	Cause     string        `json:"cause"`  // one of CauseCount, CauseSet, CauseCorrection, CauseReset, CauseSnapshot
+	DxIn      int           `json:"dx_in"`  // in of counted data, for CauseCount
+	DxOut     int           `json:"dx_out"` // out of counted data, for CauseCount
+	In        int           `json:"in"`
+	Out       int           `json:"out"`
+	Occupants int           `json:"occupants"`
+	Level     CapacityLevel `json:"level"`
+}
+
+// Subscribe returns channel, which receive Update whenever occupants changed.
+//
+// Channel closed when `ctx` done or counter closed.
+//
+// Counter never wait for slow consumer.
+// When channel is full, oldest Update dropped to make room for new one,
+// so consumer always get latest state, and can detect missed Update by gap of Seq.
+func (c *counter) Subscribe(ctx context.Context) <-chan Update {
+	ch := make(chan Update, subscriptionBuffer)
+
+	c.mux.Lock()
+	select {
+	case <-c.done:
+		c.mux.Unlock()
+		close(ch)
+		return ch
+	default:
+	}
+	c.subscribers[ch] = struct{}{}
+	c.mux.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.done:
+		}
+
+		c.mux.Lock()
+		delete(c.subscribers, ch)
+		c.mux.Unlock()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// publish send update to subscribers without blocking, caller must hold lock
+func (c *counter) publish(update Update) {
+	for ch := range c.subscribers {
+		for {
+			select {
+			case ch <- update:
+			default:
+				// drop oldest, and try again
+				select {
+				case <-ch:
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCounterSubscribe(t *testing.T) {
+	c := Counter()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := c.Subscribe(ctx)
+
+	c.Count(&CacheData{Year: 21, Month: 5, Day: 13, Hour: 13, Minute: 51, Secound: 42, DxIn: 2})
+	c.Correct(1, "test", "")
+
+	u := <-updates
+	if u.Cause != CauseCount || u.DxIn != 2 || u.Occupants != 2 || u.Seq != 1 {
+		t.Errorf("Update = %+v, want count of 2", u)
+	}
+	u = <-updates
+	if u.Cause != CauseCorrection || u.Occupants != 1 || u.In != 2 || u.Seq != 2 {
+		t.Errorf("Update = %+v, want correction to 1", u)
+	}
+
+	// slow consumer get latest updates
+	for i := 0; i < subscriptionBuffer*2; i++ {
+		c.Correct(i, "test", "")
+	}
+	var last Update
+	for i := 0; i < subscriptionBuffer; i++ {
+		last = <-updates
+	}
+	if last.Occupants != subscriptionBuffer*2-1 {
+		t.Errorf("last Update = %+v, want occupants %d", last, subscriptionBuffer*2-1)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
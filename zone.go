@@ -0,0 +1,32 @@
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpc015
+
+import "fmt"
+
+// ZoneMap maps serial number of device to zone, such as room or store,
+// where device installed.
+//
+// Several devices can belong to one zone, for example, room with two doors.
+type ZoneMap map[uint32]string
+
+// Counters maps zone to its counter.
+// Device not mapped by ZoneMap is zone of its own, named by SerialString.
+type Counters map[string]*counter
+
+// Zone returns zone of device.
+// If device not mapped, returns empty string.
+func (m ZoneMap) Zone(serialNumber uint32) string {
+	if m == nil {
+		return ""
+	}
+	return m[serialNumber]
+}
+
+// SerialString format serial number as hex, such as `42AE5152`.
+// It is name of zone of unmapped device, and used by logs and metrics.
+// Event keep serial number as number, decimal in JSON.
+func SerialString(serialNumber uint32) string {
+	return fmt.Sprintf("%08X", serialNumber)
+}